@@ -0,0 +1,197 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/dmajkic/ibis/jsonapi"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// Records are stored in bucket named by resource type, as JSONAPI resource
+// objects keyed by id. Index bucket of attribute "Title" is "Article:Title",
+// with keys of attribute value, zero byte and record key, and empty values.
+
+// indexKey returns key of index entry
+func indexKey(value string, key []byte) []byte {
+	return append(append([]byte(value), 0), key...)
+}
+
+// prepare creates buckets of schema in writable transaction, and
+// fills index buckets that are added after records were stored
+func (s *schema) prepare(tx *bbolt.Tx) error {
+	data, err := tx.CreateBucketIfNotExists([]byte(s.name))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range s.indexes {
+		if tx.Bucket(s.indexBucket(name)) != nil {
+			continue
+		}
+
+		index, err := tx.CreateBucket(s.indexBucket(name))
+		if err != nil {
+			return err
+		}
+
+		err = data.ForEach(func(key, record []byte) error {
+			item, err := s.decode(key, record)
+			if err != nil {
+				return err
+			}
+
+			if value, ok := s.attributeValue(item, name); ok {
+				return index.Put(indexKey(value, key), []byte{})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decode returns item of stored record. Attributes that model no longer has are ignored.
+func (s *schema) decode(key, data []byte) (reflect.Value, error) {
+	resource := &jsonapi.Resource{}
+	if err := json.Unmarshal(data, resource); err != nil {
+		return reflect.Value{}, fmt.Errorf("%v record %q: %v", s.name, key, err)
+	}
+
+	item, err := s.build(reflect.Value{}, resource.ID, resource, false)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("%v record %q: %v", s.name, key, err)
+	}
+
+	return item, nil
+}
+
+// get returns item of record key
+func (s *schema) get(tx *bbolt.Tx, key []byte) (reflect.Value, bool, error) {
+	data := tx.Bucket([]byte(s.name))
+	if data == nil {
+		return reflect.Value{}, false, nil
+	}
+
+	record := data.Get(key)
+	if record == nil {
+		return reflect.Value{}, false, nil
+	}
+
+	item, err := s.decode(key, record)
+	return item, err == nil, err
+}
+
+// put stores item with key, and adds it to index buckets
+func (s *schema) put(tx *bbolt.Tx, key []byte, item reflect.Value) error {
+	record, err := json.Marshal(s.record(item))
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Bucket([]byte(s.name)).Put(key, record); err != nil {
+		return err
+	}
+
+	for _, name := range s.indexes {
+		if value, ok := s.attributeValue(item, name); ok {
+			if err := tx.Bucket(s.indexBucket(name)).Put(indexKey(value, key), []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// remove deletes item with key, and its index entries
+func (s *schema) remove(tx *bbolt.Tx, key []byte, item reflect.Value) error {
+	for _, name := range s.indexes {
+		if value, ok := s.attributeValue(item, name); ok {
+			if err := tx.Bucket(s.indexBucket(name)).Delete(indexKey(value, key)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Bucket([]byte(s.name)).Delete(key)
+}
+
+// lookup returns keys of records with attribute equal to one of values.
+// If index bucket is not created yet, records are scanned.
+func (s *schema) lookup(tx *bbolt.Tx, name string, values []string) (map[string]bool, error) {
+	keys := make(map[string]bool)
+
+	index := tx.Bucket(s.indexBucket(name))
+	if index == nil {
+		wanted := make(map[string]bool, len(values))
+		for _, value := range values {
+			wanted[value] = true
+		}
+
+		err := s.scan(tx, nil, func(key []byte, item reflect.Value) error {
+			if value, ok := s.attributeValue(item, name); ok && wanted[value] {
+				keys[string(key)] = true
+			}
+			return nil
+		})
+
+		return keys, err
+	}
+
+	c := index.Cursor()
+	for _, value := range values {
+		prefix := indexKey(value, nil)
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys[string(k[len(prefix):])] = true
+		}
+	}
+
+	return keys, nil
+}
+
+// scan calls fn for records with keys, in key order. All records
+// are scanned if keys is nil.
+func (s *schema) scan(tx *bbolt.Tx, keys map[string]bool, fn func(key []byte, item reflect.Value) error) error {
+	data := tx.Bucket([]byte(s.name))
+	if data == nil {
+		return nil
+	}
+
+	if keys == nil {
+		return data.ForEach(func(key, record []byte) error {
+			item, err := s.decode(key, record)
+			if err != nil {
+				return err
+			}
+			return fn(key, item)
+		})
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		item, ok, err := s.get(tx, []byte(key))
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			if err := fn([]byte(key), item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
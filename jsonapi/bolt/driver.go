@@ -0,0 +1,571 @@
+// Package bolt implements JSONAPI database on bbolt key-value store, for
+// single binary deployments without database server. Resources are stored
+// as JSON in bucket per resource type, with index buckets for filterable
+// attributes and parent keys. Each call runs in its own bolt transaction.
+package bolt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dmajkic/ibis/jsonapi"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// LockTimeout limits wait for database file that is opened by other process
+var LockTimeout = 10 * time.Second
+
+type boltDriver struct {
+	sync.RWMutex
+
+	db *bbolt.DB
+	tx *bbolt.Tx
+}
+
+func init() {
+	jsonapi.RegisterDriver("bolt", &boltDriver{})
+}
+
+// ConnectDB opens database file from dbUrl, creating it if needed
+func (d *boltDriver) ConnectDB(config map[string]string) error {
+	path := config["dbUrl"]
+	if path == "" {
+		return errors.New("Missing database file in DbURL")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: LockTimeout})
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.db != nil {
+		d.db.Close()
+	}
+	d.db = db
+
+	return nil
+}
+
+// connected returns driver with current database, or error if it is not connected
+func (d *boltDriver) connected() (*boltDriver, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	if d.db == nil {
+		return nil, errors.New("Bolt database is not connected")
+	}
+
+	return &boltDriver{db: d.db, tx: d.tx}, nil
+}
+
+// view runs fn in read-only transaction, or in transaction of driver if there is one
+func (d *boltDriver) view(fn func(tx *bbolt.Tx) error) error {
+	if d.tx != nil {
+		return fn(d.tx)
+	}
+
+	return d.db.View(fn)
+}
+
+// update runs fn in writable transaction, or in transaction of driver if there is one
+func (d *boltDriver) update(fn func(tx *bbolt.Tx) error) error {
+	if d.tx != nil {
+		return fn(d.tx)
+	}
+
+	return d.db.Update(fn)
+}
+
+// fieldNames returns attribute names by resource type, for Fieldsets.Check.
+// Models with own ResourceConvertor are not checked.
+func (s *schema) fieldNames() map[string]map[string]bool {
+	known := make(map[string]map[string]bool)
+
+	if _, ok := s.prototype().(jsonapi.ResourceConvertor); !ok {
+		known[s.name] = s.attributeNames()
+	}
+
+	return known
+}
+
+// attributeNames returns set of attribute names
+func (s *schema) attributeNames() map[string]bool {
+	names := make(map[string]bool, len(s.fields))
+	for name := range s.fields {
+		names[name] = true
+	}
+
+	return names
+}
+
+// checkIncludes rejects include paths, since only models with
+// own ResourceConvertor can have relationships
+func (s *schema) checkIncludes(paths []string) error {
+	if _, ok := s.prototype().(jsonapi.ResourceConvertor); !ok && len(paths) > 0 {
+		return jsonapi.ErrParameter("include", "Unknown relationship path %q", paths[0])
+	}
+
+	return nil
+}
+
+// limit returns n, but not more than max
+func limit(n, max int) int {
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// FindAll returns records of model. If model is Scoper, only records of
+// parentID are returned. Filters "eq" and "in" on indexed attributes and
+// id use index buckets, other filters are applied to found records.
+func (d *boltDriver) FindAll(model interface{}, parentID interface{}, query *jsonapi.Query) (result *jsonapi.DocCollection, err error) {
+	c, err := d.connected()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newSchema(model)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.view(func(tx *bbolt.Tx) error {
+		result, err = c.findAll(tx, s, parentID, query)
+		return err
+	})
+
+	return result, jsonapi.DatabaseError(err)
+}
+
+func (d *boltDriver) findAll(tx *bbolt.Tx, s *schema, parentID interface{}, query *jsonapi.Query) (*jsonapi.DocCollection, error) {
+	proto := s.prototype()
+
+	if err := query.Fields.Check(s.fieldNames()); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkIncludes(query.Include); err != nil {
+		return nil, err
+	}
+
+	allowed := s.attributeNames()
+
+	if err := jsonapi.CheckSort(proto, query.Sort, allowed); err != nil {
+		return nil, err
+	}
+
+	// filter[name]=value, and filter[id][in]=1,2
+	if err := jsonapi.CheckFilters(proto, query.Filters, allowed); err != nil {
+		return nil, err
+	}
+
+	if err := query.Page.Check(jsonapi.OffsetPagination); err != nil {
+		return nil, err
+	}
+
+	keys, filters, err := s.candidates(tx, parentID, query.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter and sort all items by their attributes, and convert only page with includes
+	items := []reflect.Value{}
+	err = s.scan(tx, keys, func(key []byte, item reflect.Value) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]*jsonapi.Resource, len(items))
+	index := make(map[*jsonapi.Resource]int, len(items))
+
+	for i := range all {
+		all[i] = s.toResource(items[i], jsonapi.NewIncludes())
+		index[all[i]] = i
+	}
+
+	all, err = jsonapi.FilterResources(all, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonapi.SortResources(all, query.Sort)
+
+	total := len(all)
+	all = all[limit(query.Page.Offset(), total):limit(query.Page.Offset()+query.Page.Size, total)]
+
+	collection := make([]*jsonapi.Resource, len(all))
+	includes := jsonapi.NewIncludes(query.Include...)
+
+	for i := range collection {
+		collection[i] = s.toResource(items[index[all[i]]], includes)
+	}
+
+	included := includes.ToArray()
+	query.Fields.Apply(collection...)
+	query.Fields.Apply(included...)
+
+	result := &jsonapi.DocCollection{
+		Data:     collection,
+		Included: included,
+		JSONApi:  &jsonapi.VersionMeta{Version: "1.0"},
+	}
+	result.Paginate(query, total)
+
+	return result, nil
+}
+
+// candidates returns keys of records in parent scope that match filters
+// on indexed attributes and id, with nil if all records are candidates.
+// Filters that are not answered by index are returned.
+func (s *schema) candidates(tx *bbolt.Tx, parentID interface{}, filters []jsonapi.Filter) (map[string]bool, []jsonapi.Filter, error) {
+	var keys map[string]bool
+
+	narrow := func(found map[string]bool) {
+		if keys == nil {
+			keys = found
+			return
+		}
+
+		for key := range keys {
+			if !found[key] {
+				delete(keys, key)
+			}
+		}
+	}
+
+	if parent := fmt.Sprintf("%v", parentID); s.parent != "" && parentID != nil && parent != "" {
+		// Parent id of other type matches no records
+		found := make(map[string]bool)
+
+		if value, err := jsonapi.ParseValue(s.fields[s.parent].Type, parent); err == nil {
+			v, _ := indexValue(reflect.ValueOf(value))
+			if found, err = s.lookup(tx, s.parent, []string{v}); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		narrow(found)
+	}
+
+	rest := []jsonapi.Filter{}
+
+	for _, filter := range filters {
+		if filter.Op != jsonapi.FilterEq && filter.Op != jsonapi.FilterIn {
+			rest = append(rest, filter)
+			continue
+		}
+
+		switch {
+		case filter.Name == "id":
+			found := make(map[string]bool, len(filter.Values))
+			for _, id := range filter.Values {
+				if key, err := s.key(id); err == nil {
+					found[string(key)] = true
+				}
+			}
+			narrow(found)
+
+		case s.isIndexed(filter.Name):
+			values := make([]string, len(filter.Values))
+			for i, value := range filter.Values {
+				v, err := jsonapi.ParseValue(s.fields[filter.Name].Type, value)
+				if err != nil {
+					return nil, nil, jsonapi.ErrParameter(filter.Parameter, "%v", err)
+				}
+				values[i], _ = indexValue(reflect.ValueOf(v))
+			}
+
+			found, err := s.lookup(tx, filter.Name, values)
+			if err != nil {
+				return nil, nil, err
+			}
+			narrow(found)
+
+		default:
+			rest = append(rest, filter)
+		}
+	}
+
+	return keys, rest, nil
+}
+
+func (d *boltDriver) FindRecord(model, id interface{}, query *jsonapi.Query) (result *jsonapi.DocItem, err error) {
+	c, err := d.connected()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newSchema(model)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.view(func(tx *bbolt.Tx) error {
+		result, err = c.findRecord(tx, s, fmt.Sprintf("%v", id), query)
+		return err
+	})
+
+	return result, jsonapi.DatabaseError(err)
+}
+
+func (d *boltDriver) findRecord(tx *bbolt.Tx, s *schema, id string, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	if err := query.Fields.Check(s.fieldNames()); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkIncludes(query.Include); err != nil {
+		return nil, err
+	}
+
+	key, err := s.key(id)
+	if err != nil {
+		return nil, jsonapi.ErrNotFound
+	}
+
+	item, ok, err := s.get(tx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, jsonapi.ErrNotFound
+	}
+
+	includes := jsonapi.NewIncludes(query.Include...)
+	resource := s.toResource(item, includes)
+
+	included := includes.ToArray()
+	query.Fields.Apply(resource)
+	query.Fields.Apply(included...)
+
+	return &jsonapi.DocItem{
+		Data:     resource,
+		Included: included,
+		JSONApi:  &jsonapi.VersionMeta{Version: "1.0"},
+	}, nil
+}
+
+func (d *boltDriver) Delete(model interface{}, id interface{}) error {
+	c, err := d.connected()
+	if err != nil {
+		return err
+	}
+
+	s, err := newSchema(model)
+	if err != nil {
+		return err
+	}
+
+	return jsonapi.DatabaseError(c.update(func(tx *bbolt.Tx) error {
+		if err := s.prepare(tx); err != nil {
+			return err
+		}
+
+		key, err := s.key(fmt.Sprintf("%v", id))
+		if err != nil {
+			return jsonapi.ErrNotFound
+		}
+
+		item, ok, err := s.get(tx, key)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return jsonapi.ErrNotFound
+		}
+
+		return s.remove(tx, key, item)
+	}))
+}
+
+// Update applies attributes of document to record. Id of record is not changed.
+func (d *boltDriver) Update(model interface{}, id interface{}, doc *jsonapi.DocItem) error {
+	c, err := d.connected()
+	if err != nil {
+		return err
+	}
+
+	s, err := newSchema(model)
+	if err != nil {
+		return err
+	}
+
+	return jsonapi.DatabaseError(c.update(func(tx *bbolt.Tx) error {
+		if err := s.prepare(tx); err != nil {
+			return err
+		}
+
+		key, err := s.key(fmt.Sprintf("%v", id))
+		if err != nil {
+			return jsonapi.ErrNotFound
+		}
+
+		item, ok, err := s.get(tx, key)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return jsonapi.ErrNotFound
+		}
+
+		updated, err := s.build(item, "", doc.Data, true)
+		if err != nil {
+			return err
+		}
+
+		if err := s.remove(tx, key, item); err != nil {
+			return err
+		}
+
+		return s.put(tx, key, updated)
+	}))
+}
+
+// Create stores new record. Client-generated id is used as it is, else id
+// is created by IDGenerator of resource options. Integer ids are taken from
+// bucket sequence by default, and others are UUIDs.
+func (d *boltDriver) Create(model interface{}, doc *jsonapi.DocItem) (result *jsonapi.DocItem, err error) {
+	c, err := d.connected()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newSchema(model)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.update(func(tx *bbolt.Tx) error {
+		result, err = c.create(tx, s, doc)
+		return err
+	})
+
+	return result, jsonapi.DatabaseError(err)
+}
+
+func (d *boltDriver) create(tx *bbolt.Tx, s *schema, doc *jsonapi.DocItem) (*jsonapi.DocItem, error) {
+	if err := s.prepare(tx); err != nil {
+		return nil, err
+	}
+
+	data := tx.Bucket([]byte(s.name))
+
+	id := doc.Data.ID
+	if id == "" {
+		fallback := jsonapi.UUIDv4
+		if s.isInteger() {
+			fallback = jsonapi.AutoIncrement
+		}
+
+		var err error
+		if id, err = jsonapi.NewID(s.prototype(), fallback); err != nil {
+			return nil, err
+		}
+
+		if id == "" {
+			n, err := data.NextSequence()
+			if err != nil {
+				return nil, err
+			}
+			id = strconv.FormatUint(n, 10)
+		}
+	}
+
+	item, err := s.build(reflect.Value{}, id, doc.Data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.key(s.itemID(item))
+	if err != nil {
+		e := jsonapi.NewErr(http.StatusUnprocessableEntity, "Invalid id: %v", err)
+		e.Source.Pointer = "/data/id"
+		return nil, e
+	}
+
+	if data.Get(key) != nil {
+		e := jsonapi.NewErr(http.StatusConflict, "Resource with id %q already exists", id)
+		e.Source.Pointer = "/data/id"
+		return nil, e
+	}
+
+	// Sequence continues after client-generated integer ids
+	if n, err := strconv.ParseUint(s.itemID(item), 10, 64); err == nil && s.isInteger() && n > data.Sequence() {
+		if err := data.SetSequence(n); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.put(tx, key, item); err != nil {
+		return nil, err
+	}
+
+	return d.findRecord(tx, s, s.itemID(item), jsonapi.NewQuery())
+}
+
+// Transaction runs fn in writable bolt transaction, that is rolled back
+// if fn returns error
+func (d *boltDriver) Transaction(fn func(db jsonapi.Database) error) error {
+	c, err := d.connected()
+	if err != nil {
+		return err
+	}
+
+	return jsonapi.DatabaseError(c.update(func(tx *bbolt.Tx) error {
+		return fn(&boltDriver{db: c.db, tx: tx})
+	}))
+}
+
+// ToResource converts model to resource. Struct fields are attributes,
+// except ID field, same as in none driver.
+func (d *boltDriver) ToResource(value interface{}, includes *jsonapi.Includes) *jsonapi.Resource {
+	s, err := newSchema(value)
+	if err != nil {
+		return &jsonapi.Resource{
+			ID:         fmt.Sprintf("%v", value),
+			Type:       reflect.Indirect(reflect.ValueOf(value)).Type().Name(),
+			Attributes: map[string]interface{}{"value": value},
+		}
+	}
+
+	return s.toResource(reflect.ValueOf(value), includes)
+}
+
+// toResource converts item to resource, using ResourceConvertor
+// and Resourcer interfaces of model if there are ones
+func (s *schema) toResource(item reflect.Value, includes *jsonapi.Includes) *jsonapi.Resource {
+	value := item.Interface()
+
+	if convertor, implements := value.(jsonapi.ResourceConvertor); implements {
+		return convertor.ToResource(includes)
+	}
+
+	resource := s.record(item)
+	resource.Relationships = make(map[string]*jsonapi.Relationship)
+
+	if v, ok := value.(jsonapi.Resourcer); ok {
+		resource.ID = v.GetID()
+	}
+
+	return resource
+}
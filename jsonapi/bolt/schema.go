@@ -0,0 +1,274 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmajkic/ibis/jsonapi"
+)
+
+// Scoper is implemented by models that belong to parent resource. ParentKey
+// returns attribute that holds parent id, ie. "UserID". It is indexed, and
+// FindAll returns only records of parentID.
+type Scoper interface {
+	ParentKey() string
+}
+
+// schema describes model type stored in bucket. Struct fields are resource
+// attributes, same as in none driver, and ID field is record key.
+type schema struct {
+	name string
+	typ  reflect.Type
+	elem reflect.Type
+
+	id     reflect.StructField
+	fields map[string]reflect.StructField
+
+	// indexes are indexed attributes, sorted
+	indexes []string
+	parent  string
+}
+
+// newSchema returns schema of model, that is named struct or pointer to it
+func newSchema(model interface{}) (*schema, error) {
+	typ := reflect.TypeOf(model)
+	elem := typ
+	for elem != nil && elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	if elem == nil || elem.Kind() != reflect.Struct || elem.Name() == "" {
+		return nil, jsonapi.NewErr(http.StatusInternalServerError, "Bolt database supports only named struct models")
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		typ = reflect.PtrTo(elem)
+	}
+
+	s := &schema{
+		name:   elem.Name(),
+		typ:    typ,
+		elem:   elem,
+		fields: make(map[string]reflect.StructField),
+	}
+
+	found := false
+	for i := 0; i < elem.NumField(); i++ {
+		f := elem.Field(i)
+		if f.Anonymous || f.PkgPath != "" {
+			continue
+		}
+
+		if strings.ToUpper(f.Name) == "ID" {
+			s.id, found = f, true
+			continue
+		}
+
+		s.fields[jsonapi.LowerInitial(f.Name)] = f
+	}
+
+	if !found {
+		return nil, jsonapi.NewErr(http.StatusInternalServerError, "Model %v has no ID field", s.name)
+	}
+
+	proto := s.prototype()
+	indexed := make(map[string]bool)
+
+	if scoper, ok := proto.(Scoper); ok {
+		s.parent = scoper.ParentKey()
+		indexed[s.parent] = true
+	}
+
+	if filterable, ok := proto.(jsonapi.Filterable); ok {
+		for _, name := range filterable.FilterableFields() {
+			indexed[name] = true
+		}
+	}
+
+	for name := range indexed {
+		if _, ok := s.fields[name]; ok {
+			s.indexes = append(s.indexes, name)
+		}
+	}
+	sort.Strings(s.indexes)
+
+	if _, ok := s.fields[s.parent]; s.parent != "" && !ok {
+		return nil, jsonapi.NewErr(http.StatusInternalServerError, "Model %v has no parent key %q", s.name, s.parent)
+	}
+
+	return s, nil
+}
+
+// prototype returns zero value of model type, for model interfaces
+func (s *schema) prototype() interface{} {
+	if s.typ.Kind() == reflect.Ptr {
+		return reflect.New(s.elem).Interface()
+	}
+
+	return reflect.Zero(s.elem).Interface()
+}
+
+// indexBucket returns name of index bucket of attribute
+func (s *schema) indexBucket(name string) []byte {
+	return []byte(s.name + ":" + name)
+}
+
+// isIndexed reports if attribute has index bucket
+func (s *schema) isIndexed(name string) bool {
+	i := sort.SearchStrings(s.indexes, name)
+	return i < len(s.indexes) && s.indexes[i] == name
+}
+
+// isInteger reports if id is integer. Integer ids are autoincremented
+// by bucket sequence, and stored as big endian keys, so they are ordered.
+func (s *schema) isInteger() bool {
+	switch s.id.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+// key returns record key of id
+func (s *schema) key(id string) ([]byte, error) {
+	if !s.isInteger() {
+		if id == "" {
+			return nil, fmt.Errorf("Empty id")
+		}
+		return []byte(id), nil
+	}
+
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Expected positive integer, got %q", id)
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	return key, nil
+}
+
+// itemID returns id of item, as it is stored in record
+func (s *schema) itemID(item reflect.Value) string {
+	return fmt.Sprintf("%v", reflect.Indirect(item).FieldByIndex(s.id.Index).Interface())
+}
+
+// record returns resource stored for item. Attributes are always read
+// from struct fields, even if model has own ResourceConvertor.
+func (s *schema) record(item reflect.Value) *jsonapi.Resource {
+	value := reflect.Indirect(item)
+
+	resource := &jsonapi.Resource{
+		ID:         s.itemID(item),
+		Type:       s.name,
+		Attributes: make(map[string]interface{}, len(s.fields)),
+	}
+
+	for name, f := range s.fields {
+		resource.Attributes[name] = value.FieldByIndex(f.Index).Interface()
+	}
+
+	return resource
+}
+
+// build returns item with attributes of resource applied to base item.
+// Base is invalid value for new items. Id is set only if it is not empty.
+// Unknown attributes are errors, unless strict is false.
+func (s *schema) build(base reflect.Value, id string, resource *jsonapi.Resource, strict bool) (reflect.Value, error) {
+	names := make([]string, 0, len(resource.Relationships))
+	for name := range resource.Relationships {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		e := jsonapi.NewErr(http.StatusUnprocessableEntity, "Unknown relationship %q", name)
+		e.Source.Pointer = "/data/relationships/" + name
+		return reflect.Value{}, e
+	}
+
+	value := reflect.New(s.elem).Elem()
+	if base.IsValid() {
+		value.Set(reflect.Indirect(base))
+	}
+
+	names = names[:0]
+	for name := range resource.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := jsonapi.Errors{}
+
+	for _, name := range names {
+		f, ok := s.fields[name]
+		if !ok {
+			if strict {
+				errs = append(errs, jsonapi.ErrAttribute(name, "Unknown attribute %q", name))
+			}
+			continue
+		}
+
+		v, err := jsonapi.DecodeValue(f.Type, resource.Attributes[name])
+		if err != nil {
+			errs = append(errs, jsonapi.ErrAttribute(name, "%v", err))
+			continue
+		}
+		value.FieldByIndex(f.Index).Set(v)
+	}
+
+	if id != "" {
+		v, err := jsonapi.ParseValue(s.id.Type, id)
+		if err == nil && !reflect.TypeOf(v).ConvertibleTo(s.id.Type) {
+			err = fmt.Errorf("Unsupported id type %v", s.id.Type)
+		}
+
+		if err != nil {
+			e := jsonapi.NewErr(http.StatusUnprocessableEntity, "Invalid id: %v", err)
+			e.Source.Pointer = "/data/id"
+			errs = append(errs, e)
+		} else {
+			value.FieldByIndex(s.id.Index).Set(reflect.ValueOf(v).Convert(s.id.Type))
+		}
+	}
+
+	if len(errs) > 0 {
+		return reflect.Value{}, errs
+	}
+
+	if s.typ.Kind() == reflect.Ptr {
+		return value.Addr(), nil
+	}
+
+	return value, nil
+}
+
+// indexValue returns value of attribute as it is stored in index bucket.
+// Nil values are not indexed.
+func indexValue(value reflect.Value) (string, bool) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "", false
+		}
+		value = value.Elem()
+	}
+
+	if t, ok := value.Interface().(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano), true
+	}
+
+	return fmt.Sprintf("%v", value.Interface()), true
+}
+
+// attributeValue returns index value of item attribute
+func (s *schema) attributeValue(item reflect.Value, name string) (string, bool) {
+	return indexValue(reflect.Indirect(item).FieldByIndex(s.fields[name].Index))
+}
@@ -0,0 +1,561 @@
+package jsonapi
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is used when CacheOptions.Size is zero
+var DefaultCacheSize = 1024
+
+// CacheOptions are settings of Cached database
+type CacheOptions struct {
+	// TTL is how long results are kept. Zero keeps them until
+	// they are evicted or invalidated.
+	TTL time.Duration
+
+	// Size is maximum number of cached results. Least recently
+	// used results are evicted first.
+	Size int
+}
+
+// CacheStats are counters of Cached database
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+// CacheDatabase is database returned by Cached
+type CacheDatabase interface {
+	Database
+	Stats() CacheStats
+}
+
+// CachedDatabase caches FindRecord and FindAll results of database, by model
+// type, id or parent id, and query. Results of model type are dropped when
+// resource of that type is created, updated or deleted through it, and all
+// results are dropped when relationship is changed.
+//
+// Results are shared by all clients, so it is meant for reference data that
+// is same for everyone, ie. countries or currencies. If database is bound to
+// client request with WithRequest, ie. remote database forwarding credentials,
+// its results are cached by authenticated user, Authorization and
+// Accept-Language of request. Relationship endpoints are not cached.
+type CachedDatabase struct {
+	db    Database
+	cache *cache
+
+	// client identifies request that database is bound to, or is empty
+	client string
+
+	// written holds model types changed within transaction, or nil
+	written map[string]bool
+}
+
+// Cached returns database with cache of FindRecord and FindAll results of db.
+// It implements RelationshipDatabase, RelatedDatabase and TransactionDatabase
+// only if db does.
+func Cached(db Database, options CacheOptions) CacheDatabase {
+	if options.Size <= 0 {
+		options.Size = DefaultCacheSize
+	}
+
+	return wrap(&CachedDatabase{
+		db: db,
+		cache: &cache{
+			options:     options,
+			entries:     make(map[string]*list.Element),
+			byType:      make(map[string]map[string]*list.Element),
+			generations: make(map[string]uint64),
+			lru:         list.New(),
+		},
+	})
+}
+
+// Stats returns hit, miss and eviction counters, and number of cached results
+func (c *CachedDatabase) Stats() CacheStats {
+	c.cache.Lock()
+	defer c.cache.Unlock()
+
+	stats := c.cache.stats
+	stats.Entries = c.cache.lru.Len()
+
+	return stats
+}
+
+func (c *CachedDatabase) ConnectDB(config map[string]string) error {
+	return c.db.ConnectDB(config)
+}
+
+func (c *CachedDatabase) FindAll(model, parentID interface{}, query *Query) (*DocCollection, error) {
+	if c.written != nil {
+		return c.db.FindAll(model, parentID, query)
+	}
+
+	typ := cacheType(model)
+	key := fmt.Sprintf("all|%v|%v|%v|%v", c.client, typ, parentID, queryKey(query))
+
+	if value, ok := c.cache.get(key); ok {
+		return value.(*DocCollection).clone(), nil
+	}
+
+	generation := c.cache.generation(typ)
+
+	result, err := c.db.FindAll(model, parentID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.put(key, typ, generation, result.clone())
+	return result, nil
+}
+
+func (c *CachedDatabase) FindRecord(model, id interface{}, query *Query) (*DocItem, error) {
+	if c.written != nil {
+		return c.db.FindRecord(model, id, query)
+	}
+
+	typ := cacheType(model)
+	key := fmt.Sprintf("record|%v|%v|%v|%v", c.client, typ, id, queryKey(query))
+
+	if value, ok := c.cache.get(key); ok {
+		return value.(*DocItem).clone(), nil
+	}
+
+	generation := c.cache.generation(typ)
+
+	result, err := c.db.FindRecord(model, id, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.put(key, typ, generation, result.clone())
+	return result, nil
+}
+
+func (c *CachedDatabase) Delete(model, id interface{}) error {
+	defer c.invalidate(model)
+
+	return c.db.Delete(model, id)
+}
+
+func (c *CachedDatabase) Update(model, id interface{}, doc *DocItem) error {
+	defer c.invalidate(model)
+
+	return c.db.Update(model, id, doc)
+}
+
+func (c *CachedDatabase) Create(model interface{}, doc *DocItem) (*DocItem, error) {
+	defer c.invalidate(model)
+
+	return c.db.Create(model, doc)
+}
+
+// allTypes marks that all results are dropped after transaction
+const allTypes = "*"
+
+// invalidate drops results of model type, or marks type to be dropped after transaction
+func (c *CachedDatabase) invalidate(model interface{}) {
+	if c.written != nil {
+		c.written[cacheType(model)] = true
+		return
+	}
+
+	c.cache.invalidate(cacheType(model))
+}
+
+// invalidateAll drops all results, since relationship change
+// can change resources of related model type as well
+func (c *CachedDatabase) invalidateAll() {
+	if c.written != nil {
+		c.written[allTypes] = true
+		return
+	}
+
+	c.cache.invalidateAll()
+}
+
+// WithRequest returns cached database bound to client request, sharing cache.
+// Results of database that is RequestDatabase are not shared with other clients.
+func (c *CachedDatabase) WithRequest(request *http.Request) Database {
+	client := c.client
+	if _, ok := c.db.(RequestDatabase); ok {
+		client = fmt.Sprintf("%v|%v|%v", RequestUser(request),
+			request.Header.Get("Authorization"), request.Header.Get("Accept-Language"))
+	}
+
+	return wrap(&CachedDatabase{db: ForRequest(c.db, request), cache: c.cache, client: client, written: c.written})
+}
+
+// AttributeName returns attribute name of model field, as named by database
+func (c *CachedDatabase) AttributeName(model interface{}, field string) string {
+	if namer, ok := c.db.(AttributeNamer); ok {
+		return namer.AttributeName(model, field)
+	}
+
+	return LowerInitial(field)
+}
+
+func (c *CachedDatabase) ToResource(value interface{}, includes *Includes) *Resource {
+	return c.db.ToResource(value, includes)
+}
+
+// wrap returns cached database c, that implements optional interfaces of wrapped database
+func wrap(c *CachedDatabase) CacheDatabase {
+	_, relationships := c.db.(RelationshipDatabase)
+	_, related := c.db.(RelatedDatabase)
+	_, transactions := c.db.(TransactionDatabase)
+
+	r, d, t := cachedRelationships{c}, cachedRelated{c}, cachedTransactions{c}
+
+	switch {
+	case relationships && related && transactions:
+		return struct {
+			*CachedDatabase
+			cachedRelationships
+			cachedRelated
+			cachedTransactions
+		}{c, r, d, t}
+	case relationships && related:
+		return struct {
+			*CachedDatabase
+			cachedRelationships
+			cachedRelated
+		}{c, r, d}
+	case relationships && transactions:
+		return struct {
+			*CachedDatabase
+			cachedRelationships
+			cachedTransactions
+		}{c, r, t}
+	case related && transactions:
+		return struct {
+			*CachedDatabase
+			cachedRelated
+			cachedTransactions
+		}{c, d, t}
+	case relationships:
+		return struct {
+			*CachedDatabase
+			cachedRelationships
+		}{c, r}
+	case related:
+		return struct {
+			*CachedDatabase
+			cachedRelated
+		}{c, d}
+	case transactions:
+		return struct {
+			*CachedDatabase
+			cachedTransactions
+		}{c, t}
+	}
+
+	return c
+}
+
+// cachedRelationships forwards RelationshipDatabase of cached database.
+// Changes of relationships drop all cached results.
+type cachedRelationships struct {
+	c *CachedDatabase
+}
+
+func (r cachedRelationships) FindRelationship(model, id interface{}, name string) (*Relationship, error) {
+	return r.c.db.(RelationshipDatabase).FindRelationship(model, id, name)
+}
+
+func (r cachedRelationships) UpdateRelationship(model, id interface{}, name string, data *RelationshipData) error {
+	defer r.c.invalidateAll()
+
+	return r.c.db.(RelationshipDatabase).UpdateRelationship(model, id, name, data)
+}
+
+func (r cachedRelationships) AddRelationship(model, id interface{}, name string, data *RelationshipData) error {
+	defer r.c.invalidateAll()
+
+	return r.c.db.(RelationshipDatabase).AddRelationship(model, id, name, data)
+}
+
+func (r cachedRelationships) DeleteRelationship(model, id interface{}, name string, data *RelationshipData) error {
+	defer r.c.invalidateAll()
+
+	return r.c.db.(RelationshipDatabase).DeleteRelationship(model, id, name, data)
+}
+
+// cachedRelated forwards RelatedDatabase of cached database, without caching
+type cachedRelated struct {
+	c *CachedDatabase
+}
+
+func (r cachedRelated) Relationships(model interface{}) map[string]bool {
+	return r.c.db.(RelatedDatabase).Relationships(model)
+}
+
+func (r cachedRelated) FindRelatedRecord(model, id interface{}, name string, query *Query) (*DocItem, error) {
+	return r.c.db.(RelatedDatabase).FindRelatedRecord(model, id, name, query)
+}
+
+func (r cachedRelated) FindRelatedAll(model, id interface{}, name string, query *Query) (*DocCollection, error) {
+	return r.c.db.(RelatedDatabase).FindRelatedAll(model, id, name, query)
+}
+
+// cachedTransactions forwards TransactionDatabase of cached database
+type cachedTransactions struct {
+	c *CachedDatabase
+}
+
+// Transaction runs fn in transaction of database. Reads within transaction
+// are not cached, and results of changed types are dropped when it ends.
+func (t cachedTransactions) Transaction(fn func(db Database) error) error {
+	c := t.c
+
+	written := c.written
+	if written == nil {
+		written = make(map[string]bool)
+
+		defer func() {
+			if written[allTypes] {
+				c.cache.invalidateAll()
+				return
+			}
+
+			for typ := range written {
+				c.cache.invalidate(typ)
+			}
+		}()
+	}
+
+	return c.db.(TransactionDatabase).Transaction(func(tx Database) error {
+		return fn(wrap(&CachedDatabase{db: tx, cache: c.cache, client: c.client, written: written}))
+	})
+}
+
+// cacheType returns cache key of model type. Model slices of none
+// driver are told apart by their first item.
+func cacheType(model interface{}) string {
+	typ := modelType(model)
+	if typ == nil {
+		return "<nil>"
+	}
+
+	if v := reflect.ValueOf(model); v.Kind() == reflect.Slice {
+		return fmt.Sprintf("%v.%v@%x", typ.PkgPath(), typ, v.Pointer())
+	}
+
+	return fmt.Sprintf("%v.%v", typ.PkgPath(), typ)
+}
+
+// queryKey returns normalized query, with include paths sorted
+func queryKey(query *Query) string {
+	if query == nil {
+		return ""
+	}
+
+	include := append([]string{}, query.Include...)
+	sort.Strings(include)
+
+	return fmt.Sprintf("%v|%v|%v|%+v|%v|%v", include, query.Fields, query.Sort, query.Page, query.Filters, query.Values.Encode())
+}
+
+// cache is LRU list of results, indexed by key and by model type
+type cache struct {
+	sync.Mutex
+
+	options CacheOptions
+	entries map[string]*list.Element
+	byType  map[string]map[string]*list.Element
+	lru     *list.List
+	stats   CacheStats
+
+	// generations are increased when model type is invalidated, and epoch
+	// when all types are, so that results read before are not cached after
+	generations map[string]uint64
+	epoch       uint64
+}
+
+type cacheEntry struct {
+	key     string
+	typ     string
+	expires time.Time
+	value   interface{}
+}
+
+func (c *cache) get(key string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	element, ok := c.entries[key]
+	if ok {
+		entry := element.Value.(*cacheEntry)
+		if entry.expires.IsZero() || time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(element)
+			c.stats.Hits++
+			return entry.value, true
+		}
+
+		c.remove(element)
+	}
+
+	c.stats.Misses++
+	return nil, false
+}
+
+func (c *cache) generation(typ string) uint64 {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.generations[typ] + c.epoch
+}
+
+// put caches value, if model type was not invalidated since generation
+func (c *cache) put(key, typ string, generation uint64, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.generations[typ]+c.epoch != generation {
+		return
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	entry := &cacheEntry{key: key, typ: typ, value: value}
+	if c.options.TTL > 0 {
+		entry.expires = time.Now().Add(c.options.TTL)
+	}
+
+	element := c.lru.PushFront(entry)
+	c.entries[key] = element
+
+	if c.byType[typ] == nil {
+		c.byType[typ] = make(map[string]*list.Element)
+	}
+	c.byType[typ][key] = element
+
+	for c.lru.Len() > c.options.Size {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// invalidate drops results of model type
+func (c *cache) invalidate(typ string) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, element := range c.byType[typ] {
+		c.remove(element)
+	}
+
+	c.generations[typ]++
+}
+
+// invalidateAll drops all results
+func (c *cache) invalidateAll() {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, elements := range c.byType {
+		for _, element := range elements {
+			c.remove(element)
+		}
+	}
+
+	c.epoch++
+}
+
+func (c *cache) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	delete(c.byType[entry.typ], entry.key)
+
+	if len(c.byType[entry.typ]) == 0 {
+		delete(c.byType, entry.typ)
+	}
+}
+
+// Cached documents are copied, with own maps and links, since handlers change them
+
+func (d *DocItem) clone() *DocItem {
+	result := *d
+	result.Data = cloneResource(d.Data)
+	result.Included = cloneResources(d.Included)
+	result.Meta = cloneMap(d.Meta)
+
+	if d.Links != nil {
+		links := *d.Links
+		result.Links = &links
+	}
+
+	return &result
+}
+
+func (d *DocCollection) clone() *DocCollection {
+	result := *d
+	result.Data = cloneResources(d.Data)
+	result.Included = cloneResources(d.Included)
+	result.Meta = cloneMap(d.Meta)
+
+	if d.Links != nil {
+		links := *d.Links
+		result.Links = &links
+	}
+
+	return &result
+}
+
+func cloneResources(resources []*Resource) []*Resource {
+	if resources == nil {
+		return nil
+	}
+
+	result := make([]*Resource, len(resources))
+	for i, resource := range resources {
+		result[i] = cloneResource(resource)
+	}
+
+	return result
+}
+
+func cloneResource(resource *Resource) *Resource {
+	if resource == nil {
+		return nil
+	}
+
+	result := *resource
+	result.Attributes = cloneMap(resource.Attributes)
+	result.Links = cloneMap(resource.Links)
+	result.Meta = cloneMap(resource.Meta)
+
+	if resource.Relationships != nil {
+		result.Relationships = make(map[string]*Relationship, len(resource.Relationships))
+		for name, relationship := range resource.Relationships {
+			result.Relationships[name] = relationship
+		}
+	}
+
+	return &result
+}
+
+func cloneMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+
+	result := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		result[key] = value
+	}
+
+	return result
+}
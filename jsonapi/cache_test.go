@@ -0,0 +1,246 @@
+package jsonapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type Country struct {
+	ID   int
+	Name string
+}
+
+type Currency struct {
+	ID   int
+	Code string
+}
+
+// countingDatabase returns resources with number of reads as "read"
+// attribute, so that cached results are told apart from new ones
+type countingDatabase struct {
+	reads int
+
+	// during is called while result is read, if set
+	during func()
+}
+
+func (d *countingDatabase) read(id interface{}) *Resource {
+	d.reads++
+	if d.during != nil {
+		d.during()
+	}
+
+	return &Resource{ID: fmt.Sprintf("%v", id), Type: "countries", Attributes: map[string]interface{}{"read": d.reads}}
+}
+
+func (d *countingDatabase) ConnectDB(config map[string]string) error { return nil }
+
+func (d *countingDatabase) FindAll(model, parentID interface{}, query *Query) (*DocCollection, error) {
+	return &DocCollection{Data: []*Resource{d.read(1)}}, nil
+}
+
+func (d *countingDatabase) FindRecord(model, id interface{}, query *Query) (*DocItem, error) {
+	return &DocItem{Data: d.read(id)}, nil
+}
+
+func (d *countingDatabase) Delete(model, id interface{}) error { return nil }
+
+func (d *countingDatabase) Update(model, id interface{}, doc *DocItem) error { return nil }
+
+func (d *countingDatabase) Create(model interface{}, doc *DocItem) (*DocItem, error) {
+	return doc, nil
+}
+
+func (d *countingDatabase) ToResource(value interface{}, includes *Includes) *Resource { return nil }
+
+// requestDatabase returns Authorization header of client request as "auth" attribute
+type requestDatabase struct {
+	*countingDatabase
+	auth string
+}
+
+func (d *requestDatabase) FindRecord(model, id interface{}, query *Query) (*DocItem, error) {
+	doc, err := d.countingDatabase.FindRecord(model, id, query)
+	doc.Data.Attributes["auth"] = d.auth
+	return doc, err
+}
+
+func (d *requestDatabase) WithRequest(request *http.Request) Database {
+	return &requestDatabase{countingDatabase: d.countingDatabase, auth: request.Header.Get("Authorization")}
+}
+
+// readCount returns read attribute of record, that is the same for cached results
+func readCount(t *testing.T, db Database, model, id interface{}, query *Query) int {
+	doc, err := db.FindRecord(model, id, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc.Data.Attributes["read"].(int)
+}
+
+func TestCacheHitMiss(t *testing.T) {
+	db := Cached(&countingDatabase{}, CacheOptions{})
+
+	first := readCount(t, db, Country{}, 1, NewQuery())
+	if second := readCount(t, db, Country{}, 1, NewQuery()); second != first {
+		t.Errorf("record is read again")
+	}
+
+	if readCount(t, db, Country{}, 2, NewQuery()) == first {
+		t.Errorf("other record is read from cache")
+	}
+
+	sorted := NewQuery()
+	sorted.Sort = []SortField{{Name: "name"}}
+	if readCount(t, db, Country{}, 1, sorted) == first {
+		t.Errorf("record with other query is read from cache")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := db.FindAll(Country{}, nil, NewQuery()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := CacheStats{Hits: 2, Misses: 4, Entries: 4}
+	if stats := db.Stats(); stats != expected {
+		t.Errorf("got stats %+v, expected %+v", stats, expected)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	db := Cached(&countingDatabase{}, CacheOptions{TTL: 20 * time.Millisecond})
+
+	first := readCount(t, db, Country{}, 1, NewQuery())
+	if readCount(t, db, Country{}, 1, NewQuery()) != first {
+		t.Errorf("record is read again before TTL")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if readCount(t, db, Country{}, 1, NewQuery()) == first {
+		t.Errorf("record is read from cache after TTL")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	db := Cached(&countingDatabase{}, CacheOptions{Size: 2})
+
+	one := readCount(t, db, Country{}, 1, NewQuery())
+	two := readCount(t, db, Country{}, 2, NewQuery())
+
+	// Record 1 is used more recently than record 2, that is evicted for record 3
+	readCount(t, db, Country{}, 1, NewQuery())
+	readCount(t, db, Country{}, 3, NewQuery())
+
+	if stats := db.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("got stats %+v", stats)
+	}
+
+	if readCount(t, db, Country{}, 1, NewQuery()) != one {
+		t.Errorf("recently used record is evicted")
+	}
+
+	if readCount(t, db, Country{}, 2, NewQuery()) == two {
+		t.Errorf("least recently used record is not evicted")
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	for name, write := range map[string]func(db Database) error{
+		"Create": func(db Database) error {
+			_, err := db.Create(Country{}, &DocItem{Data: NewResource("countries", "")})
+			return err
+		},
+		"Update": func(db Database) error {
+			return db.Update(Country{}, 1, &DocItem{Data: NewResource("countries", "1")})
+		},
+		"Delete": func(db Database) error {
+			return db.Delete(Country{}, 2)
+		},
+	} {
+		db := Cached(&countingDatabase{}, CacheOptions{})
+
+		country := readCount(t, db, Country{}, 1, NewQuery())
+		currency := readCount(t, db, Currency{}, 1, NewQuery())
+
+		if err := write(db); err != nil {
+			t.Fatal(err)
+		}
+
+		if readCount(t, db, Country{}, 1, NewQuery()) == country {
+			t.Errorf("%v: changed type is read from cache", name)
+		}
+
+		if readCount(t, db, Currency{}, 1, NewQuery()) != currency {
+			t.Errorf("%v: other type is read again", name)
+		}
+	}
+}
+
+func TestCacheWriteDuringRead(t *testing.T) {
+	counting := &countingDatabase{}
+	db := Cached(counting, CacheOptions{})
+
+	// Result read before concurrent write is returned, but not cached
+	counting.during = func() {
+		counting.during = nil
+		if err := db.Update(Country{}, 1, &DocItem{Data: NewResource("countries", "1")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := readCount(t, db, Country{}, 1, NewQuery())
+	if readCount(t, db, Country{}, 1, NewQuery()) == first {
+		t.Errorf("result read before write is cached")
+	}
+
+	if entries := db.Stats().Entries; entries != 1 {
+		t.Errorf("got %v entries", entries)
+	}
+}
+
+func TestCacheByClient(t *testing.T) {
+	db := Cached(&requestDatabase{countingDatabase: &countingDatabase{}}, CacheOptions{})
+
+	forClient := func(auth string) Database {
+		request := httptest.NewRequest("GET", "/countries/1", nil)
+		request.Header.Set("Authorization", auth)
+		return ForRequest(db, request)
+	}
+
+	auth := func(db Database) interface{} {
+		doc, err := db.FindRecord(Country{}, 1, NewQuery())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return doc.Data.Attributes["auth"]
+	}
+
+	for _, client := range []string{"alice", "bob", "alice"} {
+		if got := auth(forClient(client)); got != client {
+			t.Errorf("%v got result of %v", client, got)
+		}
+	}
+
+	if stats := db.Stats(); stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("got stats %+v", stats)
+	}
+
+	// Database that is not bound to request shares results of all clients
+	shared := Cached(&countingDatabase{}, CacheOptions{})
+	for _, client := range []string{"alice", "bob"} {
+		request := httptest.NewRequest("GET", "/countries/1", nil)
+		request.Header.Set("Authorization", client)
+		readCount(t, ForRequest(shared, request), Country{}, 1, NewQuery())
+	}
+
+	if stats := shared.Stats(); stats.Hits != 1 {
+		t.Errorf("got stats %+v of shared results", stats)
+	}
+}
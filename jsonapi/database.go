@@ -1,21 +1,79 @@
 package jsonapi
 
 import (
+	"context"
 	"errors"
+	"net/http"
 	"unicode"
 )
 
 // Database is ibis DB interface to model storage. It is implemented by drivers
 type Database interface {
 	ConnectDB(config map[string]string) error
-	FindAll(model, parentID interface{}, query string) (*DocCollection, error)
-	FindRecord(model, id interface{}, query string) (*DocItem, error)
+	FindAll(model, parentID interface{}, query *Query) (*DocCollection, error)
+	FindRecord(model, id interface{}, query *Query) (*DocItem, error)
 	Delete(model, id interface{}) error
 	Update(model, id interface{}, doc *DocItem) error
 	Create(model interface{}, doc *DocItem) (*DocItem, error)
 	ToResource(value interface{}, includes *Includes) *Resource
 }
 
+// RelationshipDatabase is implemented by drivers that support
+// relationship endpoints, ie. /articles/1/relationships/author.
+// Add and Delete apply only to to-many relationships.
+type RelationshipDatabase interface {
+	FindRelationship(model, id interface{}, name string) (*Relationship, error)
+	UpdateRelationship(model, id interface{}, name string, data *RelationshipData) error
+	AddRelationship(model, id interface{}, name string, data *RelationshipData) error
+	DeleteRelationship(model, id interface{}, name string, data *RelationshipData) error
+}
+
+// RelatedDatabase is implemented by drivers that support
+// related resource endpoints, ie. /articles/1/author
+type RelatedDatabase interface {
+	Relationships(model interface{}) map[string]bool
+	FindRelatedRecord(model, id interface{}, name string, query *Query) (*DocItem, error)
+	FindRelatedAll(model, id interface{}, name string, query *Query) (*DocCollection, error)
+}
+
+// TransactionDatabase is implemented by drivers that can apply several changes
+// atomically, ie. for Atomic Operations. Database passed to fn works within
+// transaction, that is rolled back if fn returns error.
+type TransactionDatabase interface {
+	Transaction(fn func(db Database) error) error
+}
+
+// RequestDatabase is implemented by drivers that need client request,
+// ie. to forward its headers to remote service. Handlers use database
+// returned by WithRequest for that request only.
+type RequestDatabase interface {
+	WithRequest(request *http.Request) Database
+}
+
+// ForRequest returns database bound to client request, if driver is RequestDatabase
+func ForRequest(db Database, request *http.Request) Database {
+	if rdb, ok := db.(RequestDatabase); ok {
+		return rdb.WithRequest(request)
+	}
+
+	return db
+}
+
+type contextKey int
+
+const userKey contextKey = iota
+
+// WithUser returns copy of request carrying id of authenticated user, so that
+// drivers can tell clients apart, ie. to let them read their own writes
+func WithUser(request *http.Request, userID interface{}) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), userKey, userID))
+}
+
+// RequestUser returns id of authenticated user set by WithUser, or nil
+func RequestUser(request *http.Request) interface{} {
+	return request.Context().Value(userKey)
+}
+
 var (
 	// ErrNotFound Record Not Found error, driver should return this for jsonapi specifed return code
 	ErrNotFound = errors.New("Record not found")
@@ -0,0 +1,181 @@
+package jsonapi
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Kinds of database errors that are reported to client
+const (
+	errOther = iota
+	errUnique
+	errForeignKey
+	errReferenced
+	errTransient
+)
+
+var (
+	// UNIQUE constraint failed: users.email (sqlite3)
+	sqliteUnique = regexp.MustCompile(`UNIQUE constraint failed: \w+\.(\w+)`)
+	// Key (email)=(ann@example.com) already exists. (postgres detail)
+	postgresKey = regexp.MustCompile(`Key \(([\w" ]+)[,)]`)
+	// FOREIGN KEY (`author_id`) REFERENCES `authors` (`id`) (mysql)
+	mysqlForeignKey = regexp.MustCompile("FOREIGN KEY \\(`?(\\w+)`?\\)")
+	// Duplicate entry '1' for key 'PRIMARY' (mysql)
+	mysqlPrimary = regexp.MustCompile(`for key '(\w+\.)?PRIMARY'`)
+)
+
+// DatabaseError translates errors of sqlite3, mysql and postgres drivers to
+// JSONAPI errors. Unique constraint violations, and deletes or updates of resources
+// that others still reference are "409 Conflict", foreign key violations
+// "422 Unprocessable Entity", and deadlocks, timeouts and busy database
+// "503 Service Unavailable". Other database errors are logged, and reported
+// without database message.
+func DatabaseError(err error) error {
+	switch err.(type) {
+	case nil, *Err, Errors:
+		return err
+	}
+
+	switch err {
+	case ErrNotFound:
+		return err
+	case sql.ErrNoRows:
+		return ErrNotFound
+	}
+
+	kind, column := classify(err)
+
+	switch kind {
+	case errUnique:
+		e := NewErr(http.StatusConflict, "Resource already exists")
+		if column == "id" {
+			e.Source.Pointer = "/data/id"
+		} else if column != "" {
+			e.Detail = "Resource with the same " + column + " already exists"
+			e.Source.Pointer = "/data/attributes/" + column
+		}
+		return e
+
+	case errForeignKey:
+		e := NewErr(http.StatusUnprocessableEntity, "Related resource does not exist")
+		e.Source.Pointer = "/data/relationships"
+		if column != "" {
+			// Foreign key of belongs_to relationship is named by relationship, ie. author_id
+			e.Source.Pointer += "/" + strings.TrimSuffix(column, "_id")
+		}
+		return e
+
+	case errReferenced:
+		return errReferencedResource()
+
+	case errTransient:
+		return NewErr(http.StatusServiceUnavailable, "Database is busy, try again later")
+	}
+
+	log.Printf("database: %v", err)
+	return NewErr(http.StatusInternalServerError, "Database error")
+}
+
+// DeleteError translates errors of delete like DatabaseError. Foreign key
+// violation of delete means that other resources still reference deleted one,
+// which sqlite does not tell apart from reference to missing resource, so it is
+// "409 Conflict" as well.
+func DeleteError(err error) error {
+	switch err.(type) {
+	case nil, *Err, Errors:
+		return err
+	}
+
+	if kind, _ := classify(err); kind == errForeignKey {
+		return errReferencedResource()
+	}
+
+	return DatabaseError(err)
+}
+
+func errReferencedResource() error {
+	return NewErr(http.StatusConflict, "Resource is referenced by other resources")
+}
+
+// classify returns kind of sqlite3, mysql or postgres error, with column that caused it
+// if database reports it. Driver error types are inspected by their fields, so that
+// driver packages are not imported.
+func classify(err error) (int, string) {
+	if err == driver.ErrBadConn || err == sql.ErrConnDone {
+		return errTransient, ""
+	}
+
+	message := err.Error()
+	v := reflect.Indirect(reflect.ValueOf(err))
+	if v.Kind() != reflect.Struct {
+		return errOther, ""
+	}
+
+	// postgres: pq.Error with SQLSTATE code and detail
+	if code := v.FieldByName("Code"); code.IsValid() && code.Kind() == reflect.String {
+		if detail := v.FieldByName("Detail"); detail.IsValid() && detail.Kind() == reflect.String {
+			message = detail.String()
+		}
+
+		state := code.String()
+		switch {
+		case state == "23505":
+			return errUnique, matchColumn(postgresKey, message)
+		case state == "23503" && strings.Contains(message, "still referenced"):
+			return errReferenced, ""
+		case state == "23503":
+			return errForeignKey, matchColumn(postgresKey, message)
+		case state == "40001" || state == "40P01" || state == "55P03" || state == "53300" ||
+			state == "57P03" || strings.HasPrefix(state, "08"):
+			return errTransient, ""
+		}
+	}
+
+	// mysql: MySQLError with error number
+	if number := v.FieldByName("Number"); number.IsValid() && number.Kind() == reflect.Uint16 {
+		switch number.Uint() {
+		case 1062:
+			if mysqlPrimary.MatchString(message) {
+				return errUnique, "id"
+			}
+			return errUnique, ""
+		case 1216, 1452:
+			return errForeignKey, matchColumn(mysqlForeignKey, message)
+		case 1217, 1451:
+			return errReferenced, ""
+		case 1040, 1205, 1213:
+			return errTransient, ""
+		}
+	}
+
+	// sqlite3: Error with primary and extended result codes
+	if code := v.FieldByName("Code"); code.IsValid() && code.Kind() == reflect.Int {
+		extended := v.FieldByName("ExtendedCode")
+
+		switch {
+		case code.Int() == 5 || code.Int() == 6: // SQLITE_BUSY, SQLITE_LOCKED
+			return errTransient, ""
+		case extended.IsValid() && (extended.Int() == 2067 || extended.Int() == 1555): // UNIQUE, PRIMARYKEY
+			return errUnique, matchColumn(sqliteUnique, message)
+		case extended.IsValid() && extended.Int() == 787: // FOREIGNKEY
+			return errForeignKey, ""
+		}
+	}
+
+	return errOther, ""
+}
+
+// matchColumn returns first submatch of re in message, without quotes
+func matchColumn(re *regexp.Regexp, message string) string {
+	if m := re.FindStringSubmatch(message); m != nil {
+		return strings.Trim(m[1], `" `)
+	}
+
+	return ""
+}
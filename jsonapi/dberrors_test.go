@@ -0,0 +1,101 @@
+package jsonapi
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// pqError and mysqlError have fields of postgres and mysql driver errors
+type pqError struct {
+	Code    string
+	Detail  string
+	Message string
+}
+
+func (e *pqError) Error() string { return e.Message }
+
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlError) Error() string { return e.Message }
+
+// openForeignKeys opens sqlite database with enforced foreign keys, where
+// pets reference owners, and owner 1 has pet 1
+func openForeignKeys(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, statement := range []string{
+		`CREATE TABLE owners (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE pets (id INTEGER PRIMARY KEY, owner_id INTEGER REFERENCES owners(id))`,
+		`INSERT INTO owners (id, name) VALUES (1, 'ann')`,
+		`INSERT INTO pets (id, owner_id) VALUES (1, 1)`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+func checkErr(t *testing.T, name string, err error, status, pointer string) {
+	e, ok := err.(*Err)
+	if !ok {
+		t.Errorf("%v: expected jsonapi error, got %v", name, err)
+		return
+	}
+
+	if e.Status != status || e.Source.Pointer != pointer {
+		t.Errorf("%v: got status %v and pointer %q, expected %v and %q", name, e.Status, e.Source.Pointer, status, pointer)
+	}
+}
+
+func TestSqliteForeignKeys(t *testing.T) {
+	db := openForeignKeys(t)
+
+	// Reference to missing resource
+	_, err := db.Exec(`INSERT INTO pets (id, owner_id) VALUES (2, 9)`)
+	checkErr(t, "insert", DatabaseError(err), "422", "/data/relationships")
+
+	_, err = db.Exec(`UPDATE pets SET owner_id = 9 WHERE id = 1`)
+	checkErr(t, "update", DatabaseError(err), "422", "/data/relationships")
+
+	// Resource that others reference
+	_, err = db.Exec(`DELETE FROM owners WHERE id = 1`)
+	checkErr(t, "delete", DeleteError(err), "409", "")
+
+	if _, err := db.Exec(`DELETE FROM pets WHERE id = 1`); DeleteError(err) != nil {
+		t.Errorf("delete: got error %v", err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM owners WHERE id = 1`); DeleteError(err) != nil {
+		t.Errorf("delete: got error %v without references", err)
+	}
+}
+
+func TestReferencedErrors(t *testing.T) {
+	for name, err := range map[string]error{
+		"postgres": &pqError{Code: "23503", Detail: `Key (id)=(1) is still referenced from table "pets".`},
+		"mysql":    &mysqlError{Number: 1451, Message: "Cannot delete or update a parent row: a foreign key constraint fails"},
+	} {
+		checkErr(t, name, DatabaseError(err), "409", "")
+		checkErr(t, name, DeleteError(err), "409", "")
+	}
+
+	for name, err := range map[string]error{
+		"postgres": &pqError{Code: "23503", Detail: `Key (owner_id)=(9) is not present in table "owners".`},
+		"mysql": &mysqlError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails " +
+			"(`test`.`pets`, CONSTRAINT `fk` FOREIGN KEY (`owner_id`) REFERENCES `owners` (`id`))"},
+	} {
+		checkErr(t, name, DatabaseError(err), "422", "/data/relationships/owner")
+	}
+}
@@ -0,0 +1,108 @@
+package jsonapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// DecodeValue converts attribute value, as decoded from JSON document, to type t.
+// Types implementing sql.Scanner scan the value, times are parsed like in
+// ParseValue, and other types are decoded from JSON representation of value.
+func DecodeValue(t reflect.Type, value interface{}) (reflect.Value, error) {
+	result := reflect.New(t)
+	_, unmarshaler := result.Interface().(json.Unmarshaler)
+	scanner, isScanner := result.Interface().(sql.Scanner)
+
+	if value == nil && !isScanner {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			return result.Elem(), nil
+		}
+
+		return result.Elem(), fmt.Errorf("Expected %v, got null", kindName(t))
+	}
+
+	if isScanner && !unmarshaler {
+		if err := scanner.Scan(value); err != nil {
+			return result.Elem(), fmt.Errorf("Expected %v, got %v", kindName(t), jsonName(value))
+		}
+		return result.Elem(), nil
+	}
+
+	// Times can be sent as dates, too
+	if str, ok := value.(string); ok && (t == timeType || (t.Kind() == reflect.Ptr && t.Elem() == timeType)) {
+		v, err := ParseValue(timeType, str)
+		if err != nil {
+			return result.Elem(), err
+		}
+
+		if t.Kind() == reflect.Ptr {
+			result.Elem().Set(reflect.New(timeType))
+			result.Elem().Elem().Set(reflect.ValueOf(v))
+		} else {
+			result.Elem().Set(reflect.ValueOf(v))
+		}
+		return result.Elem(), nil
+	}
+
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(data, result.Interface())
+	}
+
+	if err != nil {
+		return result.Elem(), fmt.Errorf("Expected %v, got %v", kindName(t), jsonName(value))
+	}
+
+	return result.Elem(), nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// kindName returns JSON name of type t, used in error messages
+func kindName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+
+	if t == timeType {
+		return "time"
+	}
+
+	return "object"
+}
+
+// jsonName returns JSON name of type of decoded value, used in error messages
+func jsonName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	}
+
+	return "object"
+}
@@ -0,0 +1,75 @@
+package jsonapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NewErr creates JSONAPI error object for HTTP status code.
+// Err implements error interface, so drivers can return it
+// to have status code and source reported to the client.
+func NewErr(httpErrorCode int, format string, args ...interface{}) *Err {
+	e := &Err{
+		Status: strconv.Itoa(httpErrorCode),
+		Title:  http.StatusText(httpErrorCode),
+		Detail: fmt.Sprintf(format, args...),
+	}
+
+	return e
+}
+
+// ErrParameter creates "400 Bad Request" error caused by query parameter
+func ErrParameter(parameter, format string, args ...interface{}) *Err {
+	e := NewErr(http.StatusBadRequest, format, args...)
+	e.Source.Parameter = parameter
+
+	return e
+}
+
+// ErrAttribute creates "422 Unprocessable Entity" error caused by resource attribute
+func ErrAttribute(attribute, format string, args ...interface{}) *Err {
+	e := NewErr(http.StatusUnprocessableEntity, format, args...)
+	e.Source.Pointer = "/data/attributes/" + attribute
+
+	return e
+}
+
+// Error implements error interface
+func (e *Err) Error() string {
+	return e.Detail
+}
+
+// StatusCode returns HTTP status code of error, or 500 if it is not set
+func (e *Err) StatusCode() int {
+	if code, err := strconv.Atoi(e.Status); err == nil {
+		return code
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Errors is a list of errors that are reported together, ie. all invalid attributes
+type Errors []error
+
+// Error implements error interface
+func (e Errors) Error() string {
+	details := make([]string, len(e))
+	for i, err := range e {
+		details[i] = err.Error()
+	}
+
+	return strings.Join(details, "; ")
+}
+
+// StatusCode returns HTTP status code of first error, or 500 if it is not set
+func (e Errors) StatusCode() int {
+	if len(e) > 0 {
+		if err, ok := e[0].(*Err); ok {
+			return err.StatusCode()
+		}
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,88 @@
+package jsonapi
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Fieldsets represents sparse fieldsets requested with
+// fields[TYPE]=name,name query parameters, by resource type
+type Fieldsets map[string][]string
+
+// ParseFieldsets extracts sparse fieldsets from query values
+func ParseFieldsets(values url.Values) Fieldsets {
+	fields := Fieldsets{}
+
+	for key, list := range values {
+		if !strings.HasPrefix(key, "fields[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+
+		names := []string{}
+		for _, value := range list {
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+
+		fields[key[len("fields["):len(key)-1]] = names
+	}
+
+	return fields
+}
+
+// Check validates fieldsets against known attribute and relationship
+// names by resource type. Fieldsets for types not in known are not checked.
+func (f Fieldsets) Check(known map[string]map[string]bool) error {
+	types := make([]string, 0, len(f))
+	for typ := range f {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	for _, typ := range types {
+		names, ok := known[typ]
+		if !ok {
+			continue
+		}
+
+		for _, name := range f[typ] {
+			if !names[name] {
+				return ErrParameter("fields["+typ+"]", "Unknown field %q for type %q", name, typ)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Apply removes attributes and relationships that are not
+// requested in fieldset for resource type
+func (f Fieldsets) Apply(resources ...*Resource) {
+	for _, r := range resources {
+		names, ok := f[r.Type]
+		if !ok {
+			continue
+		}
+
+		keep := make(map[string]bool, len(names))
+		for _, name := range names {
+			keep[name] = true
+		}
+
+		for name := range r.Attributes {
+			if !keep[name] {
+				delete(r.Attributes, name)
+			}
+		}
+
+		for name := range r.Relationships {
+			if !keep[name] {
+				delete(r.Relationships, name)
+			}
+		}
+	}
+}
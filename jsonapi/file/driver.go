@@ -0,0 +1,351 @@
+// Package file implements JSONAPI database that keeps resources in JSON
+// files, one JSONAPI document per resource type. It is meant for small
+// deployments, where several processes can share data directory.
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/dmajkic/ibis/jsonapi"
+	"github.com/dmajkic/ibis/jsonapi/none"
+)
+
+type fileDriver struct {
+	sync.Mutex
+
+	dir   string
+	store none.Store
+
+	// files holds state of loaded files by resource type,
+	// with nil for files that did not exist
+	files map[string]os.FileInfo
+}
+
+func init() {
+	jsonapi.RegisterDriver("file", &fileDriver{store: none.NewStore()})
+}
+
+// ConnectDB sets data directory from dbUrl, creating it if needed.
+// Files are loaded when resource type is first used.
+func (f *fileDriver) ConnectDB(config map[string]string) error {
+	dir := config["dbUrl"]
+	if dir == "" {
+		return errors.New("Missing data directory in DbURL")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.dir = dir
+	f.store = none.NewStore()
+	f.files = make(map[string]os.FileInfo)
+
+	return nil
+}
+
+// run calls fn with data directory locked, exclusively if write is true.
+// Collections changed by fn are saved to their files.
+func (f *fileDriver) run(write bool, fn func(s *session) error) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.dir == "" {
+		return errors.New("File database is not connected")
+	}
+
+	unlock, err := lockFile(filepath.Join(f.dir, ".lock"), write)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s := &session{driver: f, db: f.store, changed: make(map[string]interface{})}
+	if err := fn(s); err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+func (f *fileDriver) FindAll(model interface{}, parentID interface{}, query *jsonapi.Query) (result *jsonapi.DocCollection, err error) {
+	err = f.run(false, func(s *session) error {
+		result, err = s.FindAll(model, parentID, query)
+		return err
+	})
+
+	return result, err
+}
+
+func (f *fileDriver) FindRecord(model, id interface{}, query *jsonapi.Query) (result *jsonapi.DocItem, err error) {
+	err = f.run(false, func(s *session) error {
+		result, err = s.FindRecord(model, id, query)
+		return err
+	})
+
+	return result, err
+}
+
+func (f *fileDriver) Delete(model interface{}, id interface{}) error {
+	return f.run(true, func(s *session) error {
+		return s.Delete(model, id)
+	})
+}
+
+func (f *fileDriver) Update(model interface{}, id interface{}, doc *jsonapi.DocItem) error {
+	return f.run(true, func(s *session) error {
+		return s.Update(model, id, doc)
+	})
+}
+
+func (f *fileDriver) Create(model interface{}, doc *jsonapi.DocItem) (result *jsonapi.DocItem, err error) {
+	err = f.run(true, func(s *session) error {
+		result, err = s.Create(model, doc)
+		return err
+	})
+
+	return result, err
+}
+
+// Transaction runs fn with data directory locked. Changed collections are
+// saved only if fn succeeds.
+func (f *fileDriver) Transaction(fn func(db jsonapi.Database) error) error {
+	return f.run(true, func(s *session) error {
+		err := s.db.Transaction(func(tx jsonapi.Database) error {
+			return fn(&session{driver: f, db: tx.(none.Store), changed: s.changed})
+		})
+
+		// Rolled back collections are reloaded from files
+		if err != nil {
+			f.files = make(map[string]os.FileInfo)
+		}
+
+		return err
+	})
+}
+
+func (f *fileDriver) ToResource(value interface{}, includes *jsonapi.Includes) *jsonapi.Resource {
+	return f.store.ToResource(value, includes)
+}
+
+// session is database used while data directory is locked. Collections are
+// loaded from files that changed since they were read, and changed
+// collections are saved when session ends.
+type session struct {
+	driver *fileDriver
+	db     none.Store
+
+	// changed holds models of changed collections by resource type
+	changed map[string]interface{}
+}
+
+// typeName returns resource type of model, that is also name of its file
+func typeName(model interface{}) (string, error) {
+	typ := reflect.TypeOf(model)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if typ == nil || typ.Kind() != reflect.Struct || typ.Name() == "" {
+		return "", jsonapi.NewErr(http.StatusInternalServerError, "File database supports only named struct models")
+	}
+
+	return typ.Name(), nil
+}
+
+// sameFile reports if file is unchanged since it was loaded
+func sameFile(loaded, current os.FileInfo) bool {
+	if loaded == nil || current == nil {
+		return loaded == current
+	}
+
+	return os.SameFile(loaded, current) && loaded.Size() == current.Size() && loaded.ModTime().Equal(current.ModTime())
+}
+
+// load reads collection of model from its file, if it was changed by other process
+func (s *session) load(model interface{}) error {
+	name, err := typeName(model)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.driver.dir, name+".json")
+
+	current, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		current = nil
+	} else if err != nil {
+		return dataError(name, err)
+	}
+
+	if loaded, ok := s.driver.files[name]; ok && sameFile(loaded, current) {
+		return nil
+	}
+
+	doc := &jsonapi.DocCollection{}
+
+	if current != nil {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return dataError(name, err)
+		}
+
+		if err := json.Unmarshal(data, doc); err != nil {
+			return dataError(name, err)
+		}
+	}
+
+	if err := s.db.Load(model, doc.Data); err != nil {
+		return dataError(name, err)
+	}
+
+	s.driver.files[name] = current
+	return nil
+}
+
+// save writes changed collections to files. File is written to temporary
+// file first, and renamed, so readers see old or new file, and never part of it.
+func (s *session) save() error {
+	var result error
+
+	for name, model := range s.changed {
+		delete(s.changed, name)
+
+		if err := s.write(name, model); err != nil {
+			// Collection no longer matches file, so it is loaded again
+			delete(s.driver.files, name)
+			result = dataError(name, err)
+		}
+	}
+
+	return result
+}
+
+func (s *session) write(name string, model interface{}) error {
+	path := filepath.Join(s.driver.dir, name+".json")
+
+	data, err := json.MarshalIndent(&jsonapi.DocCollection{
+		Data:    s.db.Dump(model),
+		JSONApi: &jsonapi.VersionMeta{Version: "1.0"},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(s.driver.dir, name+".json.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	current, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	s.driver.files[name] = current
+	return nil
+}
+
+// dataError logs error of data file, and returns error without file details
+func dataError(name string, err error) error {
+	log.Printf("File database: %v.json: %v", name, err)
+
+	return jsonapi.NewErr(http.StatusInternalServerError, "Database error")
+}
+
+func (s *session) ConnectDB(config map[string]string) error {
+	return nil
+}
+
+func (s *session) FindAll(model interface{}, parentID interface{}, query *jsonapi.Query) (*jsonapi.DocCollection, error) {
+	if err := s.load(model); err != nil {
+		return nil, err
+	}
+
+	return s.db.FindAll(model, parentID, query)
+}
+
+func (s *session) FindRecord(model, id interface{}, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	if err := s.load(model); err != nil {
+		return nil, err
+	}
+
+	return s.db.FindRecord(model, id, query)
+}
+
+func (s *session) Delete(model interface{}, id interface{}) error {
+	if err := s.load(model); err != nil {
+		return err
+	}
+
+	if err := s.db.Delete(model, id); err != nil {
+		return err
+	}
+
+	return s.change(model)
+}
+
+func (s *session) Update(model interface{}, id interface{}, doc *jsonapi.DocItem) error {
+	if err := s.load(model); err != nil {
+		return err
+	}
+
+	if err := s.db.Update(model, id, doc); err != nil {
+		return err
+	}
+
+	return s.change(model)
+}
+
+func (s *session) Create(model interface{}, doc *jsonapi.DocItem) (*jsonapi.DocItem, error) {
+	if err := s.load(model); err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Create(model, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, s.change(model)
+}
+
+// change marks collection of model to be saved
+func (s *session) change(model interface{}) error {
+	name, err := typeName(model)
+	if err == nil {
+		s.changed[name] = model
+	}
+
+	return err
+}
+
+func (s *session) ToResource(value interface{}, includes *jsonapi.Includes) *jsonapi.Resource {
+	return s.db.ToResource(value, includes)
+}
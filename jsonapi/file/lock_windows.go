@@ -0,0 +1,56 @@
+//go:build windows
+// +build windows
+
+package file
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dmajkic/ibis/jsonapi"
+
+	"golang.org/x/sys/windows"
+)
+
+// LockTimeout limits waiting for lock held by other process
+var LockTimeout = 10 * time.Second
+
+// lockFile locks data directory with LockFileEx on lock file, shared for
+// readers and exclusive for writers. Lock is released when process exits.
+func lockFile(path string, exclusive bool) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if exclusive {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+
+	handle := windows.Handle(file.Fd())
+	deadline := time.Now().Add(LockTimeout)
+
+	for {
+		err := windows.LockFileEx(handle, flags, 0, 1, 0, &windows.Overlapped{})
+		if err == nil {
+			return func() {
+				windows.UnlockFileEx(handle, 0, 1, 0, &windows.Overlapped{})
+				file.Close()
+			}, nil
+		}
+
+		if err != windows.ERROR_LOCK_VIOLATION {
+			file.Close()
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, jsonapi.NewErr(http.StatusServiceUnavailable, "Database is locked")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
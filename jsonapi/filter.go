@@ -0,0 +1,268 @@
+package jsonapi
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filterable interface is implemented by models that list attributes
+// clients can filter by with filter[name] query parameters. Other models
+// can be filtered only by id.
+type Filterable interface {
+	FilterableFields() []string
+}
+
+// Filter operators
+const (
+	FilterEq   = "eq"
+	FilterNe   = "ne"
+	FilterLt   = "lt"
+	FilterLe   = "le"
+	FilterGt   = "gt"
+	FilterGe   = "ge"
+	FilterIn   = "in"
+	FilterLike = "like"
+	FilterNull = "null"
+)
+
+var filterOps = map[string]bool{
+	FilterEq: true, FilterNe: true, FilterLt: true, FilterLe: true, FilterGt: true,
+	FilterGe: true, FilterIn: true, FilterLike: true, FilterNull: true,
+}
+
+// Filter is one condition from filter[name]=value or filter[name][op]=value
+// query parameter. Operator "in" takes comma separated values, "null" takes true or false.
+type Filter struct {
+	Name      string
+	Op        string
+	Values    []string
+	Parameter string
+}
+
+// ParseFilters extracts filter conditions from query values
+func ParseFilters(values url.Values) ([]Filter, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	filters := make([]Filter, 0, len(keys))
+
+	for _, key := range keys {
+		parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(key, "filter["), "]"), "][")
+		if !strings.HasSuffix(key, "]") || len(parts) > 2 || parts[0] == "" {
+			return nil, ErrParameter(key, "Expected filter[name] or filter[name][op]")
+		}
+
+		filter := Filter{Name: parts[0], Op: FilterEq, Parameter: key}
+		if len(parts) == 2 {
+			filter.Op = parts[1]
+		}
+
+		if !filterOps[filter.Op] {
+			return nil, ErrParameter(key, "Unknown filter operator %q", filter.Op)
+		}
+
+		for _, value := range values[key] {
+			if filter.Op == FilterIn {
+				filter.Values = append(filter.Values, strings.Split(value, ",")...)
+			} else {
+				filter.Values = append(filter.Values, value)
+			}
+		}
+
+		if filter.Op != FilterIn && len(filter.Values) != 1 {
+			return nil, ErrParameter(key, "Expected single value for %v", key)
+		}
+
+		if filter.Op == FilterNull && filter.Values[0] != "true" && filter.Values[0] != "false" {
+			return nil, ErrParameter(key, "Expected true or false for %v", key)
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+// CheckFilters returns "400 Bad Request" error if filter is not on id, or on
+// attribute listed by Filterable model. Listed attribute must be in allowed
+// attributes of driver.
+func CheckFilters(model interface{}, filters []Filter, allowed map[string]bool) error {
+	var names []string
+	if filterable, ok := model.(Filterable); ok {
+		names = filterable.FilterableFields()
+	}
+
+	listed := whitelist(names, allowed)
+
+	for _, filter := range filters {
+		if !listed[filter.Name] {
+			return ErrParameter(filter.Parameter, "Filtering by %q is not supported", filter.Name)
+		}
+	}
+
+	return nil
+}
+
+// ParseValue converts query parameter value to type t.
+// Time values are expected in RFC3339 format, or as dates.
+func ParseValue(t reflect.Type, value string) (interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	result := reflect.New(t).Elem()
+
+	if t == reflect.TypeOf(time.Time{}) {
+		v, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if v, err = time.Parse("2006-01-02", value); err != nil {
+				return nil, fmt.Errorf("Expected time, got %q", value)
+			}
+		}
+		return v, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		result.SetString(value)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Expected boolean, got %q", value)
+		}
+		result.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(value, 10, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("Expected integer, got %q", value)
+		}
+		result.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(value, 10, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("Expected unsigned integer, got %q", value)
+		}
+		result.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(value, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("Expected number, got %q", value)
+		}
+		result.SetFloat(v)
+	default:
+		// Custom types are left to database driver
+		return value, nil
+	}
+
+	return result.Interface(), nil
+}
+
+// FilterResources returns resources that match all filter conditions, for
+// drivers that filter in memory. Filter by "id" matches resource id. Values
+// are converted to types of attribute values, with "400 Bad Request" error
+// pointing to filter parameter if conversion fails.
+func FilterResources(resources []*Resource, filters []Filter) ([]*Resource, error) {
+	if len(filters) == 0 {
+		return resources, nil
+	}
+
+	result := make([]*Resource, 0, len(resources))
+
+next:
+	for _, resource := range resources {
+		for _, filter := range filters {
+			value := resource.Attributes[filter.Name]
+			if filter.Name == "id" {
+				value = resource.ID
+			}
+
+			ok, err := MatchFilter(value, filter)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				continue next
+			}
+		}
+
+		result = append(result, resource)
+	}
+
+	return result, nil
+}
+
+// MatchFilter reports if attribute value matches filter condition. Like SQL,
+// null value matches only "null" operator, and "like" ignores case.
+func MatchFilter(value interface{}, filter Filter) (bool, error) {
+	v := reflect.Indirect(reflect.ValueOf(value))
+
+	if filter.Op == FilterNull {
+		return !v.IsValid() == (filter.Values[0] == "true"), nil
+	}
+
+	if !v.IsValid() {
+		return false, nil
+	}
+
+	if filter.Op == FilterLike {
+		return likePattern(filter.Values[0]).MatchString(fmt.Sprintf("%v", v.Interface())), nil
+	}
+
+	for _, str := range filter.Values {
+		operand, err := ParseValue(v.Type(), str)
+		if err != nil {
+			return false, ErrParameter(filter.Parameter, "%v", err)
+		}
+
+		c := CompareValues(v.Interface(), operand)
+
+		switch filter.Op {
+		case FilterEq, FilterIn:
+			if c == 0 {
+				return true, nil
+			}
+		case FilterNe:
+			return c != 0, nil
+		case FilterLt:
+			return c < 0, nil
+		case FilterLe:
+			return c <= 0, nil
+		case FilterGt:
+			return c > 0, nil
+		case FilterGe:
+			return c >= 0, nil
+		}
+	}
+
+	return false, nil
+}
+
+// likePattern converts SQL LIKE pattern with % and _ wildcards to regexp
+func likePattern(pattern string) *regexp.Regexp {
+	expr := make([]string, 0, len(pattern))
+
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr = append(expr, ".*")
+		case '_':
+			expr = append(expr, ".")
+		default:
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	return regexp.MustCompile("(?is)^" + strings.Join(expr, "") + "$")
+}
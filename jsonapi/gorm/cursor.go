@@ -0,0 +1,179 @@
+package gorm
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dmajkic/ibis/jsonapi"
+
+	"github.com/jinzhu/gorm"
+)
+
+// findPage loads models using page[number] and page[size] offset pagination
+func (g *gormDriver) findPage(db *gorm.DB, model interface{}, models reflect.Value, query *jsonapi.Query, result *jsonapi.DocCollection) error {
+	page := query.Page
+
+	var total int
+	if err := db.Model(reflect.New(models.Type().Elem().Elem()).Interface()).Count(&total).Error; err != nil {
+		return err
+	}
+
+	db = db.Scopes(OrderScopes(model, query.Sort...)...)
+	if err := db.Limit(page.Size).Offset(page.Offset()).Find(models.Interface()).Error; err != nil {
+		return err
+	}
+
+	result.Paginate(query, total)
+	return nil
+}
+
+// findCursor loads models using page[after] and page[before] keyset pagination.
+// Models are ordered by sort keys and primary key, which are encoded in cursors.
+// DefaultOrder is not used, since it would make pages unstable.
+func (g *gormDriver) findCursor(db *gorm.DB, model interface{}, models reflect.Value, query *jsonapi.Query, result *jsonapi.DocCollection) error {
+	var err error
+
+	cursor := query.Page
+	scope := g.Orm.NewScope(reflect.New(models.Type().Elem().Elem()).Interface())
+	primary := scope.PrimaryField()
+	if primary == nil {
+		return fmt.Errorf("Cursor pagination needs primary key on %v", scope.TableName())
+	}
+
+	// Keyset condition compares keys with = and <, which never match NULL values
+	for _, key := range query.Sort {
+		if field, ok := scope.FieldByName(key.Name); ok && nullable(field) {
+			return jsonapi.ErrParameter("sort", "Sorting by %q can not be used with cursor pagination, since it can be null", key.Name)
+		}
+	}
+
+	keys := append(append([]jsonapi.SortField{}, query.Sort...), jsonapi.SortField{Name: primary.DBName})
+	backward := cursor.Before != ""
+
+	token, param := cursor.After, "page[after]"
+	if backward {
+		token, param = cursor.Before, "page[before]"
+	}
+
+	if token != "" {
+		args, err := cursorArgs(scope, keys, param, token)
+		if err != nil {
+			return err
+		}
+
+		db = db.Where(keysetCondition(scope, keys, backward), args...)
+	}
+
+	for _, key := range keys {
+		column := scope.Quote(key.Name)
+		if key.Descending != backward {
+			column += " desc"
+		}
+		db = db.Order(column)
+	}
+
+	if err := db.Limit(cursor.Size + 1).Find(models.Interface()).Error; err != nil {
+		return err
+	}
+
+	list := models.Elem()
+	more := list.Len() > cursor.Size
+	if more {
+		list.Set(list.Slice(0, cursor.Size))
+	}
+
+	if backward {
+		for i, j := 0, list.Len()-1; i < j; i, j = i+1, j-1 {
+			first, last := list.Index(i).Interface(), list.Index(j).Interface()
+			list.Index(i).Set(reflect.ValueOf(last))
+			list.Index(j).Set(reflect.ValueOf(first))
+		}
+	}
+
+	var prev, next string
+	if list.Len() > 0 {
+		if (backward && more) || cursor.After != "" {
+			if prev, err = g.cursorOf(list.Index(0), keys); err != nil {
+				return err
+			}
+		}
+
+		if (!backward && more) || backward {
+			if next, err = g.cursorOf(list.Index(list.Len()-1), keys); err != nil {
+				return err
+			}
+		}
+	}
+
+	result.PaginateCursor(query, prev, next)
+	return nil
+}
+
+// nullable reports whether field can hold NULL, that is pointer or sql.Scanner like sql.NullString
+func nullable(field *gorm.Field) bool {
+	return field.Struct.Type.Kind() == reflect.Ptr || field.IsScanner
+}
+
+// cursorOf encodes key values of model to cursor
+func (g *gormDriver) cursorOf(item reflect.Value, keys []jsonapi.SortField) (string, error) {
+	scope := g.Orm.NewScope(item.Addr().Interface())
+	values := make([]interface{}, len(keys))
+
+	for i, key := range keys {
+		field, _ := scope.FieldByName(key.Name)
+		values[i] = field.Field.Interface()
+	}
+
+	return jsonapi.EncodeCursor(values...)
+}
+
+// cursorArgs decodes cursor to key values typed as model fields
+func cursorArgs(scope *gorm.Scope, keys []jsonapi.SortField, param, token string) ([]interface{}, error) {
+	raw, err := jsonapi.DecodeCursor(param, token, len(keys))
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		field, _ := scope.FieldByName(key.Name)
+		value := reflect.New(field.Struct.Type)
+
+		if err := json.Unmarshal(raw[i], value.Interface()); err != nil {
+			return nil, jsonapi.ErrParameter(param, "Invalid cursor")
+		}
+		values[i] = value.Elem().Interface()
+	}
+
+	// Arguments for each (k1 = ? AND ... AND kn > ?) term
+	args := []interface{}{}
+	for i := range keys {
+		args = append(args, values[:i+1]...)
+	}
+
+	return args, nil
+}
+
+// keysetCondition builds where clause selecting rows after (or before) cursor:
+// (k1 > ?) OR (k1 = ? AND k2 > ?) OR ...
+func keysetCondition(scope *gorm.Scope, keys []jsonapi.SortField, backward bool) string {
+	terms := make([]string, len(keys))
+
+	for i, key := range keys {
+		parts := make([]string, 0, i+1)
+		for _, equal := range keys[:i] {
+			parts = append(parts, scope.Quote(equal.Name)+" = ?")
+		}
+
+		op := " > ?"
+		if key.Descending != backward {
+			op = " < ?"
+		}
+
+		terms[i] = "(" + strings.Join(append(parts, scope.Quote(key.Name)+op), " AND ") + ")"
+	}
+
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
@@ -1,105 +1,227 @@
 package gorm
 
 import (
+	"database/sql"
+	"fmt"
+	"net/http"
 	"reflect"
 	"sync"
 
 	"github.com/dmajkic/ibis/jsonapi"
 
 	"github.com/jinzhu/gorm"
-	"github.com/nu7hatch/gouuid"
 )
 
 type gormDriver struct {
-	sync.RWMutex
+	*sync.RWMutex
 	Orm *gorm.DB
+
+	// replicas serve FindAll and FindRecord outside of transaction, or nil
+	replicas *replicas
+
+	// client identifies client of request, for read-your-writes
+	client string
 }
 
 func init() {
-	jsonapi.RegisterDriver("gorm", &gormDriver{sync.RWMutex{}, nil})
+	jsonapi.RegisterDriver("gorm", &gormDriver{RWMutex: &sync.RWMutex{}})
 }
 
-func errConv(err error) error {
-	switch err {
-	case gorm.ErrRecordNotFound:
-		return jsonapi.ErrNotFound
-	default:
+// ConnectDB opens primary database of dbUrl, and read replicas
+// of "replicas", that are separated by new lines or commas
+func (g *gormDriver) ConnectDB(config map[string]string) error {
+	db, err := gorm.Open(config["adapter"], config["dbUrl"])
+	if err != nil {
 		return err
 	}
-}
 
-func (g *gormDriver) ConnectDB(config map[string]string) error {
-	db, err := gorm.Open(config["adapter"], config["dbUrl"])
+	replicas, err := openReplicas(config["adapter"], config["replicas"])
 	if err != nil {
+		db.Close()
 		return err
 	}
 
+	if g.replicas != nil {
+		g.replicas.close()
+	}
+
 	db.LogMode(true)
 	g.Orm = db
+	g.replicas = replicas
 	return nil
 }
 
-func (g *gormDriver) FindAll(model interface{}, parentID interface{}, query string) (*jsonapi.DocCollection, error) {
-	g.Lock()
-	defer g.Unlock()
+// WithRequest returns driver that reads from primary database
+// for StickyWindow after client of request writes
+func (g *gormDriver) WithRequest(request *http.Request) jsonapi.Database {
+	return &gormDriver{RWMutex: g.RWMutex, Orm: g.Orm, replicas: g.replicas, client: clientKey(request)}
+}
+
+// read runs fn with driver reading from next healthy replica. Primary database
+// is used within transaction, if there are no healthy replicas, for client that
+// wrote within StickyWindow, and if replica fails to respond. Driver that is not
+// bound to client request with WithRequest always reads from primary database.
+func (g *gormDriver) read(fn func(r *gormDriver) error) error {
+	if g.replicas == nil || g.client == "" || g.replicas.sticky(g.client) {
+		return fn(g)
+	}
 
+	db := g.replicas.pick()
+	if db == nil {
+		return fn(g)
+	}
+
+	err := fn(&gormDriver{Orm: db})
+	if err != nil && g.replicas.failed(db) {
+		return fn(g)
+	}
+
+	return err
+}
+
+// wrote marks that client changed primary database
+func (g *gormDriver) wrote() {
+	if g.replicas != nil && g.client != "" {
+		g.replicas.wrote(g.client)
+	}
+}
+
+func (g *gormDriver) FindAll(model interface{}, parentID interface{}, query *jsonapi.Query) (*jsonapi.DocCollection, error) {
+	g.RLock()
+	defer g.RUnlock()
+
+	var result *jsonapi.DocCollection
+	err := g.read(func(r *gormDriver) (err error) {
+		result, err = r.findAll(model, query, FilterScopes(model, parentID)...)
+		return err
+	})
+
+	return result, errConv(err)
+}
+
+// findAll loads collection limited with scopes, applying query to it
+func (g *gormDriver) findAll(model interface{}, query *jsonapi.Query, scopes ...func(*gorm.DB) *gorm.DB) (*jsonapi.DocCollection, error) {
 	modelType := reflect.TypeOf(model)
 	modelsType := reflect.MakeSlice(reflect.SliceOf(modelType), 0, 0).Type()
 	models := reflect.New(modelsType)
 
-	// page[number] and page[size]
+	// fields[articles]=title,body
+	if err := query.Fields.Check(g.fieldNames(model)); err != nil {
+		return nil, err
+	}
 
-	// TODO: Query parameters - "400 Bad Requset" if not possible
-	//var q url.Values
-	//if q, err := url.ParseQuery(query); err != nil {
-	//	return nil, err
-	//}
+	// include=author,comments.author
+	preloads, err := g.preloads(model, query.Include)
+	if err != nil {
+		return nil, err
+	}
 
-	//include := q.Get("include")    // include=author,comments.author
-	//sort := q.Get("sort")          // sort=-age,name
-	//filter := q.Get("filter")      // filter=string
-	//parent_id = q.Get("parent_id") // parent_id=1234567890
-	//fileds := q.Get("fields[" + gorm.ToDBName() + "]") // fields[articles]=title,body
-	//if fields, ok := q["fields"]; ok {}
-	//if page, ok := q["page"]; ok {}
+	// sort=-created_at,name
+	if err := jsonapi.CheckSort(model, query.Sort, g.attributeNames(model)); err != nil {
+		return nil, err
+	}
+
+	// filter[title][like]=gorm%, filter[id][in]=1,2
+	if err := jsonapi.CheckFilters(model, query.Filters, g.attributeNames(model)); err != nil {
+		return nil, err
+	}
 
-	scopes := DefaultScopes(model, parentID)
+	// id is sorted and filtered by primary key column
+	scope := g.Orm.NewScope(reflect.New(modelType).Interface())
+	query = query.RenameID(scope.PrimaryKey())
 
-	if err := g.Orm.Scopes(scopes...).Find(models.Interface()).Error; err != nil {
+	where, err := WhereScope(scope, query.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	db := g.Orm.Scopes(scopes...).Scopes(where)
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+
+	result := &jsonapi.DocCollection{
+		JSONApi: &jsonapi.VersionMeta{Version: "1.0"},
+	}
+
+	// page[number] and page[size], or page[after] and page[before]
+	mode := jsonapi.GetResourceOptions(model).Pagination
+	if err := query.Page.Check(mode); err != nil {
+		return nil, err
+	}
+
+	if mode == jsonapi.CursorPagination {
+		err = g.findCursor(db, model, models, query, result)
+	} else {
+		err = g.findPage(db, model, models, query, result)
+	}
+
+	if err != nil {
 		return nil, err
 	}
 
 	collection := make([]*jsonapi.Resource, models.Elem().Len())
-	includes := jsonapi.NewIncludes()
+	includes := jsonapi.NewIncludes(query.Include...)
 
 	for i := range collection {
 		collection[i] = g.ToResource(models.Elem().Index(i).Interface(), includes)
 	}
 
-	return &jsonapi.DocCollection{
-		Data:     collection,
-		Included: includes.ToArray(),
-		JSONApi:  &jsonapi.VersionMeta{Version: "1.0"},
-	}, nil
+	included := includes.ToArray()
+	query.Fields.Apply(collection...)
+	query.Fields.Apply(included...)
+
+	result.Data = collection
+	result.Included = included
+
+	return result, nil
 }
 
-func (g *gormDriver) FindRecord(model, id interface{}, query string) (*jsonapi.DocItem, error) {
-	g.Lock()
-	defer g.Unlock()
+func (g *gormDriver) FindRecord(model, id interface{}, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	g.RLock()
+	defer g.RUnlock()
+
+	var result *jsonapi.DocItem
+	err := g.read(func(r *gormDriver) (err error) {
+		result, err = r.findRecord(model, id, query)
+		return err
+	})
+
+	return result, errConv(err)
+}
+
+func (g *gormDriver) findRecord(model, id interface{}, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	if err := query.Fields.Check(g.fieldNames(model)); err != nil {
+		return nil, err
+	}
+
+	preloads, err := g.preloads(model, query.Include)
+	if err != nil {
+		return nil, err
+	}
 
 	modelType := reflect.TypeOf(model)
 	modelCopy := reflect.New(modelType).Interface()
 
-	if err := g.Orm.Find(modelCopy, "id=?", id).Error; err != nil {
+	db := g.Orm
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+
+	if err := db.Find(modelCopy, "id=?", id).Error; err != nil {
 		return nil, errConv(err)
 	}
 
-	includes := jsonapi.NewIncludes()
+	includes := jsonapi.NewIncludes(query.Include...)
 	item := g.ToResource(modelCopy, includes)
 
+	included := includes.ToArray()
+	query.Fields.Apply(item)
+	query.Fields.Apply(included...)
+
 	return &jsonapi.DocItem{
 		Data:     item,
-		Included: includes.ToArray(),
+		Included: included,
 		JSONApi:  &jsonapi.VersionMeta{Version: "1.0"},
 	}, nil
 }
@@ -107,42 +229,161 @@ func (g *gormDriver) FindRecord(model, id interface{}, query string) (*jsonapi.D
 func (g *gormDriver) Delete(model interface{}, id interface{}) error {
 	g.Lock()
 	defer g.Unlock()
+	defer g.wrote()
 
 	modelType := reflect.TypeOf(model)
 	modelCopy := reflect.New(modelType).Interface()
 	err := g.Orm.Delete(modelCopy, "id=?", id).Error
 
-	return errConv(err)
+	return deleteErrConv(err)
 }
 
 func (g *gormDriver) Update(model interface{}, id interface{}, doc *jsonapi.DocItem) error {
 	g.Lock()
 	defer g.Unlock()
+	defer g.wrote()
 
-	err := g.Orm.First(&model, id).Updates(doc.Data.Attributes).Error
+	modelCopy := reflect.New(reflect.TypeOf(model)).Interface()
+
+	return errConv(g.transaction(func(tx *gorm.DB) error {
+		if err := tx.Find(modelCopy, "id=?", id).Error; err != nil {
+			return errConv(err)
+		}
+
+		values, err := g.decodeAttributes(tx.NewScope(modelCopy), doc.Data.Attributes)
+		if err != nil {
+			return err
+		}
 
-	return errConv(err)
+		if len(values) > 0 {
+			if err := tx.Model(modelCopy).Updates(values).Error; err != nil {
+				return err
+			}
+		}
+
+		return g.setRelationships(tx, modelCopy, doc.Data.Relationships)
+	}))
 }
 
 func (g *gormDriver) Create(model interface{}, doc *jsonapi.DocItem) (*jsonapi.DocItem, error) {
 	g.Lock()
 	defer g.Unlock()
+	defer g.wrote()
+
+	id := doc.Data.ID
+
+	err := g.transaction(func(tx *gorm.DB) error {
+		record := reflect.New(reflect.TypeOf(model)).Interface()
+		scope := tx.NewScope(record)
+
+		if _, err := g.decodeAttributes(scope, doc.Data.Attributes); err != nil {
+			return err
+		}
+
+		// Client-generated id is used as it is, else id is generated,
+		// or left to database for autoincrement keys
+		if id == "" {
+			var err error
+			if id, err = jsonapi.NewID(model, defaultGenerator(scope)); err != nil {
+				return err
+			}
+		}
+
+		if id != "" {
+			if err := g.setPrimaryKey(tx, scope, id, doc.Data.ID != ""); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+
+		id = fmt.Sprintf("%v", scope.PrimaryKeyValue())
+		return g.setRelationships(tx, record, doc.Data.Relationships)
+	})
+
+	if err != nil {
+		return nil, errConv(err)
+	}
+
+	result, err := g.findRecord(model, id, jsonapi.NewQuery())
+	return result, errConv(err)
+}
 
-	// If there is Id, user cen return "204 Ok - No Content", or retreive record by id
-	if doc.Data.ID != "" {
-		doc.Data.Attributes["id"] = doc.Data.ID
-		return nil, g.Orm.Model(model).Create(doc.Data.Attributes).Error
+// defaultGenerator leaves integer primary keys to database, and uses UUIDs for others
+func defaultGenerator(scope *gorm.Scope) jsonapi.IDGenerator {
+	if field := scope.PrimaryField(); field != nil {
+		switch field.Struct.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return jsonapi.AutoIncrement
+		}
 	}
 
-	// We create Id, and retreive new record
-	id, _ := uuid.NewV4()
-	doc.Data.Attributes["id"] = id
+	return jsonapi.UUIDv4
+}
+
+// setPrimaryKey sets id of new record. Client-generated id must be valid
+// for primary key type ("422 Unprocessable Entity"), and not used ("409 Conflict").
+func (g *gormDriver) setPrimaryKey(tx *gorm.DB, scope *gorm.Scope, id string, clientID bool) error {
+	field := scope.PrimaryField()
+	if field == nil {
+		return jsonapi.NewErr(http.StatusInternalServerError, "Model %v has no primary key", scope.TableName())
+	}
 
-	if err := g.Orm.Model(model).Create(doc.Data.Attributes).Error; err != nil {
-		return nil, err
+	value, err := jsonapi.ParseValue(field.Struct.Type, id)
+	if err != nil {
+		e := jsonapi.NewErr(http.StatusUnprocessableEntity, "Invalid id: %v", err)
+		e.Source.Pointer = "/data/id"
+		return e
+	}
+
+	if clientID {
+		var count int
+		if err := tx.Model(scope.Value).Where(scope.Quote(field.DBName)+" = ?", value).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count > 0 {
+			e := jsonapi.NewErr(http.StatusConflict, "Resource with id %q already exists", id)
+			e.Source.Pointer = "/data/id"
+			return e
+		}
+	}
+
+	return field.Set(value)
+}
+
+// Transaction runs fn with driver working within database transaction
+func (g *gormDriver) Transaction(fn func(db jsonapi.Database) error) error {
+	g.Lock()
+	defer g.Unlock()
+	defer g.wrote()
+
+	return errConv(g.transaction(func(tx *gorm.DB) error {
+		return fn(&gormDriver{RWMutex: &sync.RWMutex{}, Orm: tx})
+	}))
+}
+
+// transaction runs fn in database transaction, that is rolled back if fn returns error.
+// If driver already works within transaction, fn is a part of it.
+func (g *gormDriver) transaction(fn func(tx *gorm.DB) error) error {
+	if _, ok := g.Orm.CommonDB().(*sql.Tx); ok {
+		return fn(g.Orm)
+	}
+
+	tx := g.Orm.Begin()
+	if tx.Error != nil {
+		return tx.Error
 	}
 
-	return g.FindRecord(model, id, "")
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
 }
 
 func (g *gormDriver) ToResource(value interface{}, includes *jsonapi.Includes) *jsonapi.Resource {
@@ -158,6 +399,8 @@ func (g *gormDriver) ToResource(value interface{}, includes *jsonapi.Includes) *
 	id := ""
 	if v, ok := value.(jsonapi.Resourcer); ok && !scope.PrimaryKeyZero() {
 		id = v.GetID()
+	} else if !scope.PrimaryKeyZero() {
+		id = fmt.Sprintf("%v", scope.PrimaryKeyValue())
 	}
 
 	resource := &jsonapi.Resource{
@@ -176,14 +419,22 @@ func (g *gormDriver) ToResource(value interface{}, includes *jsonapi.Includes) *
 
 		} else if !v.IsNormal && (v.Relationship != nil) {
 
+			// Related records are loaded only for included relationships,
+			// other relationships get links, and belongs_to foreign key linkage
+			loaded := includes.Requested(v.DBName)
+
 			if (v.Relationship.Kind == "belongs_to") || (v.Relationship.Kind == "has_one") {
-				value := reflect.New(v.Field.Type())
-				value.Elem().Set(v.Field)
-				resource.SetOneRelationship(v.DBName, value.Interface(), includes)
-			} else if (v.Relationship.Kind == "has_many") || (v.Relationship.Kind == "many2many") {
-				value := reflect.New(v.Field.Type())
-				value.Elem().Set(v.Field)
-				resource.SetManyRelationship(v.DBName, jsonapi.Apis(value.Interface()), includes)
+				if loaded {
+					resource.SetOneRelationship(v.DBName, g.convertor(v.Field), includes)
+				} else {
+					resource.SetOneRelationship(v.DBName, nil, includes).Data = g.foreignKeyLinkage(scope, v.StructField)
+				}
+			} else if (v.Relationship.Kind == "has_many") || (v.Relationship.Kind == "many_to_many") {
+				if loaded {
+					resource.SetManyRelationship(v.DBName, g.convertors(v.Field), includes)
+				} else {
+					resource.SetManyRelationship(v.DBName, nil, includes)
+				}
 			}
 		}
 	}
@@ -191,3 +442,83 @@ func (g *gormDriver) ToResource(value interface{}, includes *jsonapi.Includes) *
 	// Return value
 	return resource
 }
+
+// convertor adapts related model to jsonapi.ResourceConvertor,
+// so models without own convertor use orm reflection support
+type convertor struct {
+	g     *gormDriver
+	value interface{}
+}
+
+func (c convertor) ToResource(includes *jsonapi.Includes) *jsonapi.Resource {
+	return c.g.ToResource(c.value, includes)
+}
+
+// convertor returns ResourceConvertor for loaded to-one relationship field.
+// Field that is not set converts to resource without id, that is empty linkage.
+func (g *gormDriver) convertor(field reflect.Value) jsonapi.ResourceConvertor {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return convertor{g, reflect.New(field.Type().Elem()).Interface()}
+		}
+		return convertor{g, field.Interface()}
+	}
+
+	value := reflect.New(field.Type())
+	value.Elem().Set(field)
+	return convertor{g, value.Interface()}
+}
+
+// foreignKeyLinkage returns to-one linkage of belongs_to relationship from foreign
+// key of record, so it is known without loading related record. It returns nil for
+// other relationships, and for foreign keys that are not primary key of related model.
+func (g *gormDriver) foreignKeyLinkage(scope *gorm.Scope, field *gorm.StructField) *jsonapi.RelationshipData {
+	rel := field.Relationship
+	if rel.Kind != "belongs_to" || len(rel.ForeignFieldNames) != 1 || len(rel.AssociationForeignFieldNames) != 1 {
+		return nil
+	}
+
+	related := g.Orm.NewScope(reflect.New(modelStruct(field.Struct.Type)).Interface())
+	if primary := related.PrimaryField(); primary == nil || primary.Name != rel.AssociationForeignFieldNames[0] {
+		return nil
+	}
+
+	fk, ok := scope.FieldByName(rel.ForeignFieldNames[0])
+	if !ok {
+		return nil
+	}
+
+	data := &jsonapi.RelationshipData{IsSingle: true, ResourceIds: []jsonapi.ResourceIdentifier{}}
+	if fk.IsBlank {
+		return data
+	}
+
+	data.ResourceIds = append(data.ResourceIds, jsonapi.ResourceIdentifier{
+		ID:   fmt.Sprintf("%v", reflect.Indirect(fk.Field).Interface()),
+		Type: related.TableName(),
+	})
+
+	return data
+}
+
+// convertors returns ResourceConvertors for to-many relationship field
+func (g *gormDriver) convertors(field reflect.Value) []jsonapi.ResourceConvertor {
+	field = reflect.Indirect(field)
+	if field.Kind() != reflect.Slice {
+		return []jsonapi.ResourceConvertor{}
+	}
+
+	result := make([]jsonapi.ResourceConvertor, 0, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		item := field.Index(i)
+		if item.Kind() != reflect.Ptr {
+			item = item.Addr()
+		} else if item.IsNil() {
+			continue
+		}
+
+		result = append(result, convertor{g, item.Interface()})
+	}
+
+	return result
+}
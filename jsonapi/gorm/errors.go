@@ -0,0 +1,34 @@
+package gorm
+
+import (
+	"github.com/dmajkic/ibis/jsonapi"
+
+	"github.com/jinzhu/gorm"
+)
+
+// errConv translates gorm and database errors to JSONAPI errors,
+// as described in jsonapi.DatabaseError
+func errConv(err error) error {
+	if errs, ok := err.(gorm.Errors); ok && len(errs) > 0 {
+		return errConv(errs[0])
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		return jsonapi.ErrNotFound
+	}
+
+	return jsonapi.DatabaseError(err)
+}
+
+// deleteErrConv translates errors of delete, as described in jsonapi.DeleteError
+func deleteErrConv(err error) error {
+	if errs, ok := err.(gorm.Errors); ok && len(errs) > 0 {
+		return deleteErrConv(errs[0])
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		return jsonapi.ErrNotFound
+	}
+
+	return jsonapi.DeleteError(err)
+}
@@ -1,6 +1,8 @@
 package gorm
 
 import (
+	"github.com/dmajkic/ibis/jsonapi"
+
 	"github.com/jinzhu/gorm"
 )
 
@@ -14,17 +16,115 @@ type Orderer interface {
 	DefaultOrder() func(*gorm.DB) *gorm.DB
 }
 
-// DefaultScopes adds default scopes to gorm query
-func DefaultScopes(model interface{}, parentID interface{}) []func(*gorm.DB) *gorm.DB {
-	scopes := make([]func(*gorm.DB) *gorm.DB, 0, 2)
+// DefaultScopes adds default scopes to gorm query. Sort keys requested
+// by client are applied before DefaultOrder, which only breaks ties.
+func DefaultScopes(model interface{}, parentID interface{}, sort ...jsonapi.SortField) []func(*gorm.DB) *gorm.DB {
+	return append(FilterScopes(model, parentID), OrderScopes(model, sort...)...)
+}
+
+// FilterScopes returns scopes that limit records, without ordering.
+// These are suitable for counting records.
+func FilterScopes(model interface{}, parentID interface{}) []func(*gorm.DB) *gorm.DB {
+	scopes := make([]func(*gorm.DB) *gorm.DB, 0, 1)
 
 	if scoper, ok := model.(Scoper); ok {
 		scopes = append(scopes, scoper.DefaultScope(parentID))
 	}
 
+	return scopes
+}
+
+// OrderScopes returns scopes that order records by sort keys and DefaultOrder
+func OrderScopes(model interface{}, sort ...jsonapi.SortField) []func(*gorm.DB) *gorm.DB {
+	scopes := make([]func(*gorm.DB) *gorm.DB, 0, 2)
+
+	if len(sort) > 0 {
+		scopes = append(scopes, SortScope(sort))
+	}
+
 	if orderer, ok := model.(Orderer); ok {
 		scopes = append(scopes, orderer.DefaultOrder())
 	}
 
 	return scopes
 }
+
+// SortScope orders gorm query by sort keys. Keys are expected to be checked
+// against model attributes, which are named by database columns.
+func SortScope(sort []jsonapi.SortField) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, field := range sort {
+			column := db.Dialect().Quote(field.Name)
+			if field.Descending {
+				column += " desc"
+			}
+			db = db.Order(column)
+		}
+		return db
+	}
+}
+
+var filterSQL = map[string]string{
+	jsonapi.FilterEq:   " = ?",
+	jsonapi.FilterNe:   " <> ?",
+	jsonapi.FilterLt:   " < ?",
+	jsonapi.FilterLe:   " <= ?",
+	jsonapi.FilterGt:   " > ?",
+	jsonapi.FilterGe:   " >= ?",
+	jsonapi.FilterIn:   " IN (?)",
+	jsonapi.FilterLike: " LIKE ?",
+}
+
+// WhereScope limits gorm query with filter conditions. Values are converted
+// to column types using model field metadata, with "400 Bad Request" error
+// pointing to filter parameter if conversion fails.
+func WhereScope(scope *gorm.Scope, filters []jsonapi.Filter) (func(*gorm.DB) *gorm.DB, error) {
+	clauses := make([]string, len(filters))
+	args := make([][]interface{}, len(filters))
+
+	for i, filter := range filters {
+		field, ok := scope.FieldByName(filter.Name)
+		if !ok {
+			return nil, jsonapi.ErrParameter(filter.Parameter, "Unknown filter attribute %q", filter.Name)
+		}
+
+		column := scope.Quote(field.DBName)
+
+		switch filter.Op {
+		case jsonapi.FilterNull:
+			if filter.Values[0] == "true" {
+				clauses[i] = column + " IS NULL"
+			} else {
+				clauses[i] = column + " IS NOT NULL"
+			}
+
+		case jsonapi.FilterLike:
+			clauses[i] = column + filterSQL[filter.Op]
+			args[i] = []interface{}{filter.Values[0]}
+
+		default:
+			values := make([]interface{}, len(filter.Values))
+			for j, value := range filter.Values {
+				v, err := jsonapi.ParseValue(field.Struct.Type, value)
+				if err != nil {
+					return nil, jsonapi.ErrParameter(filter.Parameter, "%v", err)
+				}
+				values[j] = v
+			}
+
+			clauses[i] = column + filterSQL[filter.Op]
+			if filter.Op == jsonapi.FilterIn {
+				args[i] = []interface{}{values}
+			} else {
+				args[i] = values
+			}
+		}
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		for i := range clauses {
+			db = db.Where(clauses[i], args[i]...)
+		}
+		return db
+	}, nil
+}
@@ -0,0 +1,116 @@
+package gorm
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/dmajkic/ibis/jsonapi"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Relationships returns relationship names of model, with true for to-one relationships
+func (g *gormDriver) Relationships(model interface{}) map[string]bool {
+	scope := g.Orm.NewScope(reflect.New(modelStruct(reflect.TypeOf(model))).Interface())
+	names := make(map[string]bool)
+
+	for _, field := range scope.GetModelStruct().StructFields {
+		if !field.IsNormal && field.Relationship != nil {
+			names[field.DBName] = isToOne(field)
+		}
+	}
+
+	return names
+}
+
+// FindRelatedRecord returns related resource of to-one relationship, with nil Data if it is empty
+func (g *gormDriver) FindRelatedRecord(model, id interface{}, name string, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	g.RLock()
+	defer g.RUnlock()
+
+	var result *jsonapi.DocItem
+	err := g.read(func(r *gormDriver) (err error) {
+		result, err = r.findRelatedRecord(model, id, name, query)
+		return err
+	})
+
+	return result, errConv(err)
+}
+
+func (g *gormDriver) findRelatedRecord(model, id interface{}, name string, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	modelCopy, field, err := g.loadRelationship(model, id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isToOne(field) {
+		return nil, jsonapi.NewErr(http.StatusNotFound, "Relationship %q is to-many", name)
+	}
+
+	value, _ := g.Orm.NewScope(modelCopy).FieldByName(field.Name)
+	related := reflect.Indirect(value.Field)
+
+	if !related.IsValid() || g.Orm.NewScope(related.Addr().Interface()).PrimaryKeyZero() {
+		return &jsonapi.DocItem{JSONApi: &jsonapi.VersionMeta{Version: "1.0"}}, nil
+	}
+
+	relatedID := g.Orm.NewScope(related.Addr().Interface()).PrimaryKeyValue()
+	return g.findRecord(reflect.Zero(related.Type()).Interface(), relatedID, query)
+}
+
+// FindRelatedAll returns related resources of to-many relationship,
+// with fields, sort, filter and pagination applied as for collection
+func (g *gormDriver) FindRelatedAll(model, id interface{}, name string, query *jsonapi.Query) (*jsonapi.DocCollection, error) {
+	g.RLock()
+	defer g.RUnlock()
+
+	var result *jsonapi.DocCollection
+	err := g.read(func(r *gormDriver) (err error) {
+		result, err = r.findRelatedAll(model, id, name, query)
+		return err
+	})
+
+	return result, errConv(err)
+}
+
+func (g *gormDriver) findRelatedAll(model, id interface{}, name string, query *jsonapi.Query) (*jsonapi.DocCollection, error) {
+	field := g.relationshipField(reflect.TypeOf(model), name)
+	if field == nil {
+		return nil, jsonapi.NewErr(http.StatusNotFound, "Unknown relationship %q", name)
+	}
+
+	if isToOne(field) {
+		return nil, jsonapi.NewErr(http.StatusNotFound, "Relationship %q is to-one", name)
+	}
+
+	modelCopy := reflect.New(modelStruct(reflect.TypeOf(model))).Interface()
+	if err := g.Orm.Find(modelCopy, "id=?", id).Error; err != nil {
+		return nil, err
+	}
+
+	relatedType := modelStruct(field.Struct.Type)
+	rel := field.Relationship
+	source := g.Orm.NewScope(modelCopy)
+
+	// Same conditions as gorm uses for Related()
+	constraint := func(db *gorm.DB) *gorm.DB {
+		if rel.Kind == "many_to_many" {
+			table := db.NewScope(reflect.New(relatedType).Interface()).QuotedTableName()
+			return rel.JoinTableHandler.JoinWith(rel.JoinTableHandler, db, modelCopy).Select(table + ".*")
+		}
+
+		for i, foreignKey := range rel.ForeignDBNames {
+			if value, ok := source.FieldByName(rel.AssociationForeignDBNames[i]); ok {
+				db = db.Where(source.Quote(foreignKey)+" = ?", value.Field.Interface())
+			}
+		}
+
+		if rel.PolymorphicType != "" {
+			db = db.Where(source.Quote(rel.PolymorphicDBName)+" = ?", rel.PolymorphicValue)
+		}
+
+		return db
+	}
+
+	return g.findAll(reflect.Zero(relatedType).Interface(), query, constraint)
+}
@@ -0,0 +1,239 @@
+package gorm
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/dmajkic/ibis/jsonapi"
+
+	"github.com/jinzhu/gorm"
+)
+
+// isToOne reports if relationship field has single related resource
+func isToOne(field *gorm.StructField) bool {
+	return field.Relationship.Kind == "belongs_to" || field.Relationship.Kind == "has_one"
+}
+
+// loadRelationship finds record by id with relationship name preloaded
+func (g *gormDriver) loadRelationship(model, id interface{}, name string) (interface{}, *gorm.StructField, error) {
+	field := g.relationshipField(reflect.TypeOf(model), name)
+	if field == nil {
+		return nil, nil, jsonapi.NewErr(http.StatusNotFound, "Unknown relationship %q", name)
+	}
+
+	modelCopy := reflect.New(modelStruct(reflect.TypeOf(model))).Interface()
+	if err := g.Orm.Preload(field.Name).Find(modelCopy, "id=?", id).Error; err != nil {
+		return nil, nil, errConv(err)
+	}
+
+	return modelCopy, field, nil
+}
+
+// relatedModels loads related records for resource linkage found at pointer.
+// Linkage type must match related model ("422 Unprocessable Entity"),
+// and all records must exist ("404 Not Found").
+func (g *gormDriver) relatedModels(db *gorm.DB, field *gorm.StructField, data *jsonapi.RelationshipData, pointer string) (reflect.Value, error) {
+	relatedType := modelStruct(field.Struct.Type)
+	scope := db.NewScope(reflect.New(relatedType).Interface())
+	list := reflect.New(reflect.SliceOf(relatedType))
+
+	ids := make([]string, 0, len(data.ResourceIds))
+	unique := make(map[string]bool)
+
+	for i, rid := range data.ResourceIds {
+		if rid.Type != scope.TableName() {
+			e := jsonapi.NewErr(http.StatusUnprocessableEntity, "Expected type %q, got %q", scope.TableName(), rid.Type)
+			e.Source.Pointer = linkagePointer(pointer, data, i, "type")
+			return list.Elem(), e
+		}
+
+		if !unique[rid.ID] {
+			unique[rid.ID] = true
+			ids = append(ids, rid.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return list.Elem(), nil
+	}
+
+	if err := db.Where(scope.Quote(scope.PrimaryKey())+" IN (?)", ids).Find(list.Interface()).Error; err != nil {
+		return list.Elem(), err
+	}
+
+	if list.Elem().Len() == len(ids) {
+		return list.Elem(), nil
+	}
+
+	// Report first resource identifier without record
+	found := make(map[string]bool)
+	for i := 0; i < list.Elem().Len(); i++ {
+		pk := db.NewScope(list.Elem().Index(i).Addr().Interface()).PrimaryKeyValue()
+		found[fmt.Sprintf("%v", pk)] = true
+	}
+
+	for i, rid := range data.ResourceIds {
+		if !found[rid.ID] {
+			e := jsonapi.NewErr(http.StatusNotFound, "Related %v resource %q not found", rid.Type, rid.ID)
+			e.Source.Pointer = linkagePointer(pointer, data, i, "id")
+			return list.Elem(), e
+		}
+	}
+
+	return list.Elem(), jsonapi.NewErr(http.StatusNotFound, "Related %v resource not found", scope.TableName())
+}
+
+// linkagePointer returns JSON pointer to member of i-th resource identifier in linkage at pointer
+func linkagePointer(pointer string, data *jsonapi.RelationshipData, i int, member string) string {
+	if data.IsSingle {
+		return fmt.Sprintf("%v/%v", pointer, member)
+	}
+
+	return fmt.Sprintf("%v/%d/%v", pointer, i, member)
+}
+
+// setRelationship replaces to-one linkage, or all members of to-many relationship of record.
+// Linkage is found at pointer in request document.
+func (g *gormDriver) setRelationship(db *gorm.DB, record interface{}, field *gorm.StructField, data *jsonapi.RelationshipData, pointer string) error {
+	if data.IsSingle != isToOne(field) {
+		e := jsonapi.NewErr(http.StatusBadRequest, "Wrong linkage for relationship %q", field.DBName)
+		e.Source.Pointer = pointer
+		return e
+	}
+
+	related, err := g.relatedModels(db, field, data, pointer)
+	if err != nil {
+		return err
+	}
+
+	// belongs_to is stored in foreign key of the record itself
+	if field.Relationship.Kind == "belongs_to" {
+		var value interface{}
+		if related.Len() > 0 {
+			value = db.NewScope(related.Index(0).Addr().Interface()).PrimaryKeyValue()
+		}
+
+		return errConv(db.Model(record).UpdateColumn(field.Relationship.ForeignDBNames[0], value).Error)
+	}
+
+	association := db.Model(record).Association(field.Name)
+	if related.Len() == 0 {
+		return association.Clear().Error
+	}
+
+	return association.Replace(related.Interface()).Error
+}
+
+// setRelationships writes relationships of resource document to record.
+// Relationships without data member are skipped.
+func (g *gormDriver) setRelationships(db *gorm.DB, record interface{}, relationships map[string]*jsonapi.Relationship) error {
+	names := make([]string, 0, len(relationships))
+	for name, rel := range relationships {
+		if rel != nil && rel.Data != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pointer := "/data/relationships/" + name
+
+		field := g.relationshipField(reflect.TypeOf(record), name)
+		if field == nil {
+			e := jsonapi.NewErr(http.StatusUnprocessableEntity, "Unknown relationship %q", name)
+			e.Source.Pointer = pointer
+			return e
+		}
+
+		if err := g.setRelationship(db, record, field, relationships[name].Data, pointer+"/data"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindRelationship returns resource linkage of relationship
+func (g *gormDriver) FindRelationship(model, id interface{}, name string) (*jsonapi.Relationship, error) {
+	g.RLock()
+	defer g.RUnlock()
+
+	var rel *jsonapi.Relationship
+	err := g.read(func(r *gormDriver) (err error) {
+		rel, err = r.findRelationship(model, id, name)
+		return err
+	})
+
+	return rel, err
+}
+
+func (g *gormDriver) findRelationship(model, id interface{}, name string) (*jsonapi.Relationship, error) {
+	modelCopy, field, err := g.loadRelationship(model, id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Relationship is loaded, as if it was included
+	rel, ok := g.ToResource(modelCopy, jsonapi.NewIncludes(field.DBName)).Relationships[name]
+	if !ok || rel.Data == nil {
+		return nil, jsonapi.NewErr(http.StatusNotFound, "Unknown relationship %q", name)
+	}
+
+	return rel, nil
+}
+
+// UpdateRelationship replaces to-one linkage, or all members of to-many relationship
+func (g *gormDriver) UpdateRelationship(model, id interface{}, name string, data *jsonapi.RelationshipData) error {
+	g.Lock()
+	defer g.Unlock()
+	defer g.wrote()
+
+	modelCopy, field, err := g.loadRelationship(model, id, name)
+	if err != nil {
+		return err
+	}
+
+	return errConv(g.setRelationship(g.Orm, modelCopy, field, data, "/data"))
+}
+
+// AddRelationship adds members to to-many relationship
+func (g *gormDriver) AddRelationship(model, id interface{}, name string, data *jsonapi.RelationshipData) error {
+	return g.changeRelationship(model, id, name, data, func(a *gorm.Association, related interface{}) error {
+		return a.Append(related).Error
+	})
+}
+
+// DeleteRelationship removes members from to-many relationship. Related records are not deleted.
+func (g *gormDriver) DeleteRelationship(model, id interface{}, name string, data *jsonapi.RelationshipData) error {
+	return g.changeRelationship(model, id, name, data, func(a *gorm.Association, related interface{}) error {
+		return a.Delete(related).Error
+	})
+}
+
+func (g *gormDriver) changeRelationship(model, id interface{}, name string, data *jsonapi.RelationshipData, change func(*gorm.Association, interface{}) error) error {
+	g.Lock()
+	defer g.Unlock()
+	defer g.wrote()
+
+	modelCopy, field, err := g.loadRelationship(model, id, name)
+	if err != nil {
+		return err
+	}
+
+	if isToOne(field) {
+		return jsonapi.NewErr(http.StatusForbidden, "Relationship %q is to-one, use PATCH to update it", name)
+	}
+
+	if data.IsSingle {
+		return jsonapi.NewErr(http.StatusBadRequest, "Expected array of resource identifiers")
+	}
+
+	related, err := g.relatedModels(g.Orm, field, data, "/data")
+	if err != nil || related.Len() == 0 {
+		return errConv(err)
+	}
+
+	return errConv(change(g.Orm.Model(modelCopy).Association(field.Name), related.Interface()))
+}
@@ -0,0 +1,189 @@
+package gorm
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmajkic/ibis/jsonapi"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	// StickyWindow is how long reads of client go to primary database after its
+	// write, so that client reads its own changes before replicas catch up
+	StickyWindow = 5 * time.Second
+
+	// HealthCheckInterval is how often replicas are pinged. Replica that fails
+	// does not serve reads until it responds again.
+	HealthCheckInterval = 10 * time.Second
+)
+
+// replicas are read-only copies of primary database, used in round-robin order
+type replicas struct {
+	sync.Mutex
+
+	dbs     []*gorm.DB
+	healthy []bool
+	next    int
+
+	// writes hold time of last write, by client
+	writes map[string]time.Time
+	stop   chan struct{}
+}
+
+// openReplicas opens replica databases of dbUrls, separated by new lines or commas.
+// It returns nil if there are none.
+func openReplicas(adapter, dbUrls string) (*replicas, error) {
+	r := &replicas{writes: make(map[string]time.Time), stop: make(chan struct{})}
+
+	for _, dbURL := range strings.FieldsFunc(dbUrls, func(c rune) bool { return c == '\n' || c == ',' }) {
+		if dbURL = strings.TrimSpace(dbURL); dbURL == "" {
+			continue
+		}
+
+		db, err := gorm.Open(adapter, dbURL)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+
+		r.dbs = append(r.dbs, db)
+		r.healthy = append(r.healthy, true)
+	}
+
+	if len(r.dbs) == 0 {
+		return nil, nil
+	}
+
+	if HealthCheckInterval > 0 {
+		go r.run(HealthCheckInterval)
+	}
+
+	return r, nil
+}
+
+// pick returns next healthy replica, or nil if there is none
+func (r *replicas) pick() *gorm.DB {
+	r.Lock()
+	defer r.Unlock()
+
+	for range r.dbs {
+		i := r.next
+		r.next = (r.next + 1) % len(r.dbs)
+
+		if r.healthy[i] {
+			return r.dbs[i]
+		}
+	}
+
+	return nil
+}
+
+// failed checks replica after failed read. It returns true if replica
+// does not respond, and it is not used until next health check restores it.
+func (r *replicas) failed(db *gorm.DB) bool {
+	if err := db.DB().Ping(); err == nil {
+		return false
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	for i := range r.dbs {
+		if r.dbs[i] == db && r.healthy[i] {
+			log.Printf("Database replica %d is not available", i+1)
+			r.healthy[i] = false
+		}
+	}
+
+	return true
+}
+
+// check pings replicas, and updates their health
+func (r *replicas) check() {
+	healthy := make([]bool, len(r.dbs))
+	for i, db := range r.dbs {
+		healthy[i] = db.DB().Ping() == nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	for i := range r.dbs {
+		if healthy[i] != r.healthy[i] {
+			if healthy[i] {
+				log.Printf("Database replica %d is available", i+1)
+			} else {
+				log.Printf("Database replica %d is not available", i+1)
+			}
+		}
+	}
+	r.healthy = healthy
+
+	// Clients that wrote before window are not tracked any more
+	for client, written := range r.writes {
+		if time.Since(written) > StickyWindow {
+			delete(r.writes, client)
+		}
+	}
+}
+
+func (r *replicas) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.check()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// wrote marks that client changed primary database
+func (r *replicas) wrote(client string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.writes[client] = time.Now()
+}
+
+// sticky returns true if client wrote within StickyWindow
+func (r *replicas) sticky(client string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	written, ok := r.writes[client]
+	return ok && time.Since(written) <= StickyWindow
+}
+
+// close stops health checks and closes replica databases
+func (r *replicas) close() {
+	close(r.stop)
+
+	for _, db := range r.dbs {
+		db.Close()
+	}
+}
+
+// clientKey identifies client of request by authenticated user, or by remote
+// address if request is not authenticated
+func clientKey(request *http.Request) string {
+	if userID := jsonapi.RequestUser(request); userID != nil {
+		return fmt.Sprintf("user:%v", userID)
+	}
+
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		return host
+	}
+
+	return request.RemoteAddr
+}
@@ -0,0 +1,155 @@
+package gorm
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmajkic/ibis/jsonapi"
+
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+type Note struct {
+	ID   int
+	Text string
+}
+
+// connectReplicas opens primary and two replica databases, with note 1
+// holding name of database it is read from
+func connectReplicas(t *testing.T) *gormDriver {
+	interval, window := HealthCheckInterval, StickyWindow
+	HealthCheckInterval, StickyWindow = 0, time.Minute
+	t.Cleanup(func() { HealthCheckInterval, StickyWindow = interval, window })
+
+	dir := t.TempDir()
+	g := &gormDriver{RWMutex: &sync.RWMutex{}}
+	err := g.ConnectDB(map[string]string{
+		"adapter":  "sqlite3",
+		"dbUrl":    filepath.Join(dir, "primary.db"),
+		"replicas": filepath.Join(dir, "r1.db") + "," + filepath.Join(dir, "r2.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		g.replicas.close()
+		g.Orm.Close()
+	})
+
+	for i, db := range append(g.replicas.dbs, g.Orm) {
+		db.LogMode(false)
+		db.AutoMigrate(&Note{})
+		db.Create(&Note{ID: 1, Text: []string{"r1", "r2", "primary"}[i]})
+	}
+
+	return g
+}
+
+// forUser returns driver bound to request of user
+func forUser(g *gormDriver, userID string) jsonapi.Database {
+	request := httptest.NewRequest("GET", "/notes/1", nil)
+	return g.WithRequest(jsonapi.WithUser(request, userID))
+}
+
+// readNote returns text of note 1, that tells database it is read from
+func readNote(t *testing.T, db jsonapi.Database) string {
+	doc, err := db.FindRecord(Note{}, 1, jsonapi.NewQuery())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc.Data.Attributes["text"].(string)
+}
+
+func reads(t *testing.T, db jsonapi.Database, count int) []string {
+	result := []string{}
+	for i := 0; i < count; i++ {
+		result = append(result, readNote(t, db))
+	}
+
+	return result
+}
+
+func TestReplicaRoundRobin(t *testing.T) {
+	g := connectReplicas(t)
+
+	if got := reads(t, forUser(g, "1"), 3); !reflect.DeepEqual(got, []string{"r1", "r2", "r1"}) {
+		t.Errorf("got reads %v", got)
+	}
+
+	// Driver that is not bound to request has no client to track
+	if got := readNote(t, g); got != "primary" {
+		t.Errorf("got read %v without request", got)
+	}
+
+	// Transaction reads what it wrote
+	g.Transaction(func(db jsonapi.Database) error {
+		if got := readNote(t, db); got != "primary" {
+			t.Errorf("got read %v in transaction", got)
+		}
+		return nil
+	})
+}
+
+func TestReplicaFailover(t *testing.T) {
+	g := connectReplicas(t)
+	db := forUser(g, "1")
+
+	g.replicas.dbs[0].DB().Close()
+
+	// Failed replica is replaced by primary, and is not used after that
+	if got := reads(t, db, 3); !reflect.DeepEqual(got, []string{"primary", "r2", "r2"}) {
+		t.Errorf("got reads %v", got)
+	}
+
+	g.replicas.check()
+	if g.replicas.healthy[0] || !g.replicas.healthy[1] {
+		t.Errorf("got health %v after check", g.replicas.healthy)
+	}
+
+	g.replicas.dbs[1].DB().Close()
+	if got := reads(t, db, 2); !reflect.DeepEqual(got, []string{"primary", "primary"}) {
+		t.Errorf("got reads %v without healthy replicas", got)
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	g := connectReplicas(t)
+	writer, other := forUser(g, "1"), forUser(g, "2")
+
+	doc := &jsonapi.DocItem{Data: &jsonapi.Resource{Type: "notes", ID: "1", Attributes: map[string]interface{}{"text": "changed"}}}
+	if err := writer.Update(Note{}, 1, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readNote(t, writer); got != "changed" {
+		t.Errorf("writer read %v", got)
+	}
+
+	// Same user is tracked across requests, ie. after token refresh
+	if got := readNote(t, forUser(g, "1")); got != "changed" {
+		t.Errorf("writer read %v in next request", got)
+	}
+
+	// Other user, even from the same address, reads from replicas
+	if got := readNote(t, other); got == "changed" {
+		t.Errorf("other user read %v", got)
+	}
+
+	StickyWindow = 10 * time.Millisecond
+	time.Sleep(20 * time.Millisecond)
+
+	if got := readNote(t, writer); got == "changed" {
+		t.Errorf("writer read %v after StickyWindow", got)
+	}
+
+	g.replicas.check()
+	if len(g.replicas.writes) != 0 {
+		t.Errorf("writes %v are tracked after StickyWindow", g.replicas.writes)
+	}
+}
@@ -0,0 +1,168 @@
+package gorm
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dmajkic/ibis/jsonapi"
+
+	"github.com/jinzhu/gorm"
+)
+
+var convertorType = reflect.TypeOf((*jsonapi.ResourceConvertor)(nil)).Elem()
+
+// modelStruct dereferences pointer and slice types down to model struct type
+func modelStruct(modelType reflect.Type) reflect.Type {
+	for modelType.Kind() == reflect.Ptr || modelType.Kind() == reflect.Slice {
+		modelType = modelType.Elem()
+	}
+
+	return modelType
+}
+
+// fieldNames returns attribute and relationship names by resource type,
+// for model and all models reachable through its relationships.
+// Models with own ResourceConvertor are not included.
+func (g *gormDriver) fieldNames(model interface{}) map[string]map[string]bool {
+	known := make(map[string]map[string]bool)
+	g.collectFieldNames(reflect.TypeOf(model), known, make(map[reflect.Type]bool))
+
+	return known
+}
+
+func (g *gormDriver) collectFieldNames(modelType reflect.Type, known map[string]map[string]bool, visited map[reflect.Type]bool) {
+	modelType = modelStruct(modelType)
+	if modelType.Kind() != reflect.Struct || visited[modelType] {
+		return
+	}
+	visited[modelType] = true
+
+	scope := g.Orm.NewScope(reflect.New(modelType).Interface())
+	names := make(map[string]bool)
+
+	// Same rules as ToResource
+	for _, field := range scope.GetModelStruct().StructFields {
+		if field.IsNormal && !field.IsPrimaryKey && !field.IsForeignKey && !field.IsIgnored {
+			names[field.DBName] = true
+		} else if !field.IsNormal && field.Relationship != nil {
+			names[field.DBName] = true
+			g.collectFieldNames(field.Struct.Type, known, visited)
+		}
+	}
+
+	if !reflect.PtrTo(modelType).Implements(convertorType) {
+		known[scope.TableName()] = names
+	}
+}
+
+// preloads validates include paths against model relationships, and
+// converts them to gorm Preload column paths, ie. "comments.author" to "Comments.Author"
+func (g *gormDriver) preloads(model interface{}, paths []string) ([]string, error) {
+	result := make([]string, len(paths))
+
+	for i, path := range paths {
+		modelType := reflect.TypeOf(model)
+		names := strings.Split(path, ".")
+		columns := make([]string, len(names))
+
+		for j, name := range names {
+			field := g.relationshipField(modelType, name)
+			if field == nil {
+				return nil, jsonapi.ErrParameter("include", "Unknown relationship path %q", path)
+			}
+
+			columns[j] = field.Name
+			modelType = field.Struct.Type
+		}
+
+		result[i] = strings.Join(columns, ".")
+	}
+
+	return result, nil
+}
+
+// relationshipField finds relationship of model type by its JSONAPI name
+func (g *gormDriver) relationshipField(modelType reflect.Type, name string) *gorm.StructField {
+	modelType = modelStruct(modelType)
+	if modelType.Kind() != reflect.Struct {
+		return nil
+	}
+
+	scope := g.Orm.NewScope(reflect.New(modelType).Interface())
+	for _, field := range scope.GetModelStruct().StructFields {
+		if !field.IsNormal && field.Relationship != nil && field.DBName == name {
+			return field
+		}
+	}
+
+	return nil
+}
+
+// attributeNames returns set of model attribute names, same as in ToResource
+func (g *gormDriver) attributeNames(model interface{}) map[string]bool {
+	scope := g.Orm.NewScope(reflect.New(modelStruct(reflect.TypeOf(model))).Interface())
+	names := make(map[string]bool)
+
+	for _, field := range scope.GetModelStruct().StructFields {
+		if field.IsNormal && !field.IsPrimaryKey && !field.IsForeignKey && !field.IsIgnored {
+			names[field.DBName] = true
+		}
+	}
+
+	return names
+}
+
+// AttributeName returns resource attribute name of model field, same as in ToResource
+func (g *gormDriver) AttributeName(model interface{}, field string) string {
+	scope := g.Orm.NewScope(reflect.New(modelStruct(reflect.TypeOf(model))).Interface())
+	if f, ok := scope.FieldByName(field); ok {
+		return f.DBName
+	}
+
+	return gorm.ToDBName(field)
+}
+
+// decodeAttributes sets resource attributes to fields of scope value, converted
+// to field types. Typed values are returned by column name. Unknown attributes
+// and values of wrong type are reported as "422 Unprocessable Entity".
+func (g *gormDriver) decodeAttributes(scope *gorm.Scope, attributes map[string]interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]*gorm.Field)
+	for _, field := range scope.Fields() {
+		if field.IsNormal && !field.IsPrimaryKey && !field.IsForeignKey && !field.IsIgnored {
+			fields[field.DBName] = field
+		}
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make(map[string]interface{})
+	errs := jsonapi.Errors{}
+
+	for _, name := range names {
+		field, ok := fields[name]
+		if !ok {
+			errs = append(errs, jsonapi.ErrAttribute(name, "Unknown attribute %q", name))
+			continue
+		}
+
+		value, err := jsonapi.DecodeValue(field.Struct.Type, attributes[name])
+		if err != nil {
+			errs = append(errs, jsonapi.ErrAttribute(name, "Invalid %v: %v", name, err))
+			continue
+		}
+
+		field.Field.Set(value)
+		values[name] = value.Interface()
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return values, nil
+}
@@ -0,0 +1,180 @@
+package jsonapi
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IDGenerator creates ids of new resources. It is set per model with
+// ResourceOptions.IDGenerator. Empty id means that database assigns it.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+var (
+	// AutoIncrement leaves id to database, ie. integer autoincrement keys
+	AutoIncrement IDGenerator = autoIncrement{}
+	// UUIDv4 generates random UUIDs
+	UUIDv4 IDGenerator = uuidV4{}
+	// UUIDv7 generates UUIDs ordered by creation time
+	UUIDv7 IDGenerator = &uuidV7{}
+	// ULID generates ULIDs ordered by creation time
+	ULID IDGenerator = &ulid{}
+)
+
+type autoIncrement struct{}
+
+func (autoIncrement) NewID() (string, error) {
+	return "", nil
+}
+
+type uuidV4 struct{}
+
+func (uuidV4) NewID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return formatUUID(b), nil
+}
+
+// uuidV7 keeps ids monotonic within millisecond, using 12 bits after
+// timestamp as sequence
+type uuidV7 struct {
+	sync.Mutex
+	ms  uint64
+	seq uint16
+}
+
+func (u *uuidV7) NewID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	u.Lock()
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms <= u.ms {
+		ms = u.ms
+		u.seq++
+		if u.seq > 0x0fff {
+			ms++
+			u.seq = 0
+		}
+	} else {
+		u.seq = binary.BigEndian.Uint16(b[6:8]) & 0x07ff
+	}
+	u.ms = ms
+	seq := u.seq
+	u.Unlock()
+
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> uint(40-8*i))
+	}
+
+	b[6] = 0x70 | byte(seq>>8) // version 7
+	b[7] = byte(seq)
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return formatUUID(b), nil
+}
+
+func formatUUID(b [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// ulid keeps ids monotonic within millisecond, by incrementing random part
+type ulid struct {
+	sync.Mutex
+	ms      uint64
+	entropy [10]byte
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (u *ulid) NewID() (string, error) {
+	var b [16]byte
+
+	u.Lock()
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms <= u.ms {
+		ms = u.ms
+		for i := len(u.entropy) - 1; i >= 0; i-- {
+			u.entropy[i]++
+			if u.entropy[i] != 0 {
+				break
+			}
+		}
+	} else if _, err := rand.Read(u.entropy[:]); err != nil {
+		u.Unlock()
+		return "", err
+	}
+	u.ms = ms
+	copy(b[6:], u.entropy[:])
+	u.Unlock()
+
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> uint(40-8*i))
+	}
+
+	// 128 bits as 26 characters of 5 bits, first character has 3 bits
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(s[:]), nil
+}
+
+// Snowflake generates 63-bit integer ids from milliseconds since Epoch,
+// node number and sequence within millisecond
+type Snowflake struct {
+	sync.Mutex
+	Node  int64
+	Epoch time.Time
+
+	ms  int64
+	seq int64
+}
+
+// NewSnowflake creates Snowflake generator for node 0-1023,
+// with epoch at 2017-01-01
+func NewSnowflake(node int64) *Snowflake {
+	return &Snowflake{
+		Node:  node & 0x3ff,
+		Epoch: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// NewID implements IDGenerator
+func (s *Snowflake) NewID() (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	ms := time.Since(s.Epoch).Nanoseconds() / int64(time.Millisecond)
+	if ms <= s.ms {
+		ms = s.ms
+		s.seq = (s.seq + 1) & 0xfff
+		if s.seq == 0 {
+			ms++
+		}
+	} else {
+		s.seq = 0
+	}
+	s.ms = ms
+
+	return strconv.FormatInt(ms<<22|(s.Node&0x3ff)<<12|s.seq, 10), nil
+}
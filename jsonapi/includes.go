@@ -1,14 +1,52 @@
 package jsonapi
 
+import (
+	"net/url"
+	"strings"
+)
+
 // Includes is implementation of JSONAPI resource array
 // included in JSONAPI document
 type Includes struct {
-	m map[string]*Resource
+	m     map[string]*Resource
+	paths map[string]bool
+	path  []string
+}
+
+// NewIncludes creates new Includes. Only related resources on requested
+// relationship paths are included, ie. "author" or "comments.author".
+// Intermediate resources on nested paths are included as well.
+func NewIncludes(paths ...string) *Includes {
+	includes := &Includes{
+		m:     make(map[string]*Resource),
+		paths: make(map[string]bool),
+	}
+
+	for _, path := range paths {
+		names := strings.Split(path, ".")
+		for i := range names {
+			includes.paths[strings.Join(names[:i+1], ".")] = true
+		}
+	}
+
+	return includes
 }
 
-// NewIncludes creates new Includes
-func NewIncludes() *Includes {
-	return &Includes{make(map[string]*Resource)}
+// ParseIncludes extracts relationship paths from include=author,comments.author query parameter
+func ParseIncludes(values url.Values) []string {
+	paths := []string{}
+	seen := make(map[string]bool)
+
+	for _, value := range values["include"] {
+		for _, path := range strings.Split(value, ",") {
+			if path = strings.TrimSpace(path); path != "" && !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	return paths
 }
 
 // Set key to resource
@@ -21,6 +59,37 @@ func (includes *Includes) Get(key string) *Resource {
 	return includes.m[key]
 }
 
+// Enter descends to relationship name while related resource is converted.
+// Every Enter must be followed by Leave.
+func (includes *Includes) Enter(name string) {
+	if includes != nil {
+		includes.path = append(includes.path, name)
+	}
+}
+
+// Leave returns from relationship entered with Enter
+func (includes *Includes) Leave() {
+	if includes != nil && len(includes.path) > 0 {
+		includes.path = includes.path[:len(includes.path)-1]
+	}
+}
+
+// Requested reports if relationship name on current path should be included
+func (includes *Includes) Requested(name string) bool {
+	if includes == nil {
+		return false
+	}
+
+	return includes.paths[strings.Join(append(includes.path, name), ".")]
+}
+
+// Add includes related resource if relationship name on current path is requested
+func (includes *Includes) Add(name string, resource *Resource) {
+	if includes.Requested(name) {
+		includes.Set(resource.Type+"/"+resource.ID, resource)
+	}
+}
+
 // ToArray converts Includes to resource array
 func (includes *Includes) ToArray() []*Resource {
 	result := make([]*Resource, len(includes.m))
@@ -2,12 +2,14 @@
 package jsonapi
 
 import (
+	"bytes"
 	"encoding/json"
 )
 
 // VersionMeta represents JSONApiObject optional version info
 type VersionMeta struct {
 	Version string                 `json:"version,omitempty"`
+	Ext     []string               `json:"ext,omitempty"`
 	Meta    map[string]interface{} `json:"meta,omitempty"`
 }
 
@@ -33,15 +35,28 @@ type DocCollection struct {
 	Included []*Resource            `json:"included,omitempty"`
 }
 
-// ResourceIdentifier represents object by type and id
+// DocRelationship represents JSONAPI document of relationship endpoint,
+// where Data is resource linkage
+type DocRelationship struct {
+	Data    RelationshipData       `json:"data"`
+	Errors  []Err                  `json:"errors,omitempty"`
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+	JSONApi *VersionMeta           `json:"jsonapi,omitempty"`
+	Links   *Links                 `json:"links,omitempty"`
+}
+
+// ResourceIdentifier represents object by type and id.
+// Lid is local id of resource created in the same request.
 type ResourceIdentifier struct {
-	ID   string `json:"id"`
+	ID   string `json:"id,omitempty"`
+	Lid  string `json:"lid,omitempty"`
 	Type string `json:"type"`
 }
 
 // Resource JSONAPI representation of single item
 type Resource struct {
 	ID            string                   `json:"id,omitempty"`
+	Lid           string                   `json:"lid,omitempty"`
 	Type          string                   `json:"type"`
 	Attributes    map[string]interface{}   `json:"attributes,omitempty"`
 	Relationships map[string]*Relationship `json:"relationships,omitempty"`
@@ -60,9 +75,10 @@ type Links struct {
 }
 
 // Relationship represents resource ToOne and ToMany relationships.
+// Data is nil if linkage is not known, ie. related resources are not loaded.
 type Relationship struct {
 	Links Links                  `json:"links,omitempty"`
-	Data  RelationshipData       `json:"data,omitempty"`
+	Data  *RelationshipData      `json:"data,omitempty"`
 	Meta  map[string]interface{} `json:"meta,omitempty"`
 }
 
@@ -90,29 +106,61 @@ func (d *DocCollection) String() string {
 	return string(data)
 }
 
-// UnmarshalJSON handles that Relationship.Data can be ResourceIdentifier or []ResourceIdentifier
-func (r *RelationshipData) UnmarshalJSON(b []byte) (err error) {
+// UnmarshalJSON sets Data only if data member is present, so that
+// "data": null is empty to-one linkage, and not missing linkage
+func (r *Relationship) UnmarshalJSON(b []byte) error {
+	var rel struct {
+		Links Links                  `json:"links"`
+		Data  json.RawMessage        `json:"data"`
+		Meta  map[string]interface{} `json:"meta"`
+	}
 
-	single := ResourceIdentifier{}
-	if err = json.Unmarshal(b, &single); err == nil {
-		r.IsSingle = true
-		r.ResourceIds = []ResourceIdentifier{single}
+	if err := json.Unmarshal(b, &rel); err != nil {
+		return err
+	}
 
+	r.Links = rel.Links
+	r.Meta = rel.Meta
+	r.Data = nil
+
+	if len(rel.Data) == 0 {
 		return nil
 	}
 
-	if err != nil {
-		return err
+	r.Data = &RelationshipData{}
+	return json.Unmarshal(rel.Data, r.Data)
+}
+
+// UnmarshalJSON handles that Relationship.Data can be ResourceIdentifier, []ResourceIdentifier or null
+func (r *RelationshipData) UnmarshalJSON(b []byte) (err error) {
+
+	data := bytes.TrimSpace(b)
+
+	if bytes.Equal(data, []byte("null")) {
+		r.IsSingle = true
+		r.ResourceIds = []ResourceIdentifier{}
+		return nil
 	}
 
-	var array []ResourceIdentifier
-	if err = json.Unmarshal(b, &array); err == nil {
+	if len(data) > 0 && data[0] == '[' {
+		var array []ResourceIdentifier
+		if err = json.Unmarshal(data, &array); err != nil {
+			return err
+		}
+
 		r.IsSingle = false
 		r.ResourceIds = array
 		return nil
 	}
 
-	return err
+	single := ResourceIdentifier{}
+	if err = json.Unmarshal(data, &single); err != nil {
+		return err
+	}
+
+	r.IsSingle = true
+	r.ResourceIds = []ResourceIdentifier{single}
+	return nil
 }
 
 // MarshalJSON marshals JSONAPI relationship data to json
@@ -141,6 +189,7 @@ type Err struct {
 	Source struct {
 		Pointer   string `json:"pointer,omitempty"`
 		Parameter string `json:"parameter,omitempty"`
+		Header    string `json:"header,omitempty"`
 	} `json:"source,omitempty"`
 	Meta map[string]interface{} `json:"meta,omitempty"`
 }
@@ -0,0 +1,149 @@
+package jsonapi
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MediaType is JSONAPI media type, used for request and response documents
+const MediaType = "application/vnd.api+json"
+
+// MediaTypeParams holds ext and profile parameters of JSONAPI media type
+type MediaTypeParams struct {
+	Ext     []string
+	Profile []string
+}
+
+// HasExt reports if extension uri is one of ext parameters
+func (p MediaTypeParams) HasExt(uri string) bool {
+	for _, ext := range p.Ext {
+		if ext == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContentType returns JSONAPI media type with ext parameter of applied extensions
+func (p MediaTypeParams) ContentType() string {
+	if len(p.Ext) == 0 {
+		return MediaType
+	}
+
+	return mime.FormatMediaType(MediaType, map[string]string{"ext": strings.Join(p.Ext, " ")})
+}
+
+// parseParams checks that JSONAPI media type has only ext and profile
+// parameters, and that all extensions are supported
+func parseParams(params map[string]string, extensions []string) (MediaTypeParams, string, bool) {
+	result := MediaTypeParams{}
+	supported := MediaTypeParams{Ext: extensions}
+
+	for name, value := range params {
+		switch name {
+		case "ext":
+			result.Ext = strings.Fields(value)
+		case "profile":
+			result.Profile = strings.Fields(value)
+		default:
+			return result, "Unsupported media type parameter " + name, false
+		}
+	}
+
+	for _, ext := range result.Ext {
+		if !supported.HasExt(ext) {
+			return result, "Unsupported extension " + ext, false
+		}
+	}
+
+	return result, "", true
+}
+
+// CheckContentType parses Content-Type header of request with document.
+// "415 Unsupported Media Type" is returned if it is not JSONAPI media type
+// with ext and profile parameters, or if extension is not one of extensions.
+func CheckContentType(contentType string, extensions ...string) (MediaTypeParams, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != MediaType {
+		e := NewErr(http.StatusUnsupportedMediaType, "Expected %v content type", MediaType)
+		e.Source.Header = "Content-Type"
+		return MediaTypeParams{}, e
+	}
+
+	result, detail, ok := parseParams(params, extensions)
+	if !ok {
+		e := NewErr(http.StatusUnsupportedMediaType, "%v", detail)
+		e.Source.Header = "Content-Type"
+		return result, e
+	}
+
+	return result, nil
+}
+
+// CheckAccept returns parameters of first acceptable JSONAPI media type in
+// Accept header. "406 Not Acceptable" is returned if all JSONAPI media types
+// have unsupported parameters, or if Accept header does not allow JSONAPI media type.
+func CheckAccept(accept string, extensions ...string) (MediaTypeParams, error) {
+	if strings.TrimSpace(accept) == "" {
+		return MediaTypeParams{}, nil
+	}
+
+	detail := "Expected " + MediaType + " in Accept header"
+	found, wildcard := false, false
+
+	for _, value := range splitAccept(accept) {
+		mediaType, params, err := mime.ParseMediaType(value)
+		if err != nil {
+			continue
+		}
+
+		// Media type with zero quality is not acceptable
+		if q, ok := params["q"]; ok {
+			if quality, err := strconv.ParseFloat(q, 64); err == nil && quality == 0 {
+				continue
+			}
+			delete(params, "q")
+		}
+
+		switch mediaType {
+		case MediaType:
+			found = true
+			result, reason, ok := parseParams(params, extensions)
+			if ok {
+				return result, nil
+			}
+			detail = reason
+		case "*/*", "application/*":
+			wildcard = true
+		}
+	}
+
+	if wildcard && !found {
+		return MediaTypeParams{}, nil
+	}
+
+	e := NewErr(http.StatusNotAcceptable, "%v", detail)
+	e.Source.Header = "Accept"
+	return MediaTypeParams{}, e
+}
+
+// splitAccept splits Accept header to media types, on commas outside of quoted strings
+func splitAccept(accept string) []string {
+	var result []string
+
+	quoted, start := false, 0
+	for i, r := range accept {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			result = append(result, accept[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(result, accept[start:])
+}
@@ -2,6 +2,7 @@ package none
 
 import (
 	"fmt"
+	"net/http"
 	"reflect"
 	"strings"
 	"sync"
@@ -9,12 +10,43 @@ import (
 	"github.com/dmajkic/ibis/jsonapi"
 )
 
+// noneDriver is in-memory database. Items are kept in typed collections
+// by resource type, that are seeded from model slices set with Resources.
 type noneDriver struct {
 	sync.RWMutex
+
+	collections map[string]*collection
+
+	// seeded holds first items of model slices already added to collections
+	seeded map[*interface{}]bool
+}
+
+// Store is in-memory database, with access to collections for
+// drivers that persist them elsewhere
+type Store interface {
+	jsonapi.Database
+	jsonapi.TransactionDatabase
+
+	// Load replaces items of model collection with resources
+	Load(model interface{}, resources []*jsonapi.Resource) error
+	// Dump returns items of model collection as resources
+	Dump(model interface{}) []*jsonapi.Resource
 }
 
 func init() {
-	jsonapi.RegisterDriver("none", &noneDriver{sync.RWMutex{}})
+	jsonapi.RegisterDriver("none", newDriver())
+}
+
+// NewStore returns in-memory database, separate from one registered as "none" driver
+func NewStore() Store {
+	return newDriver()
+}
+
+func newDriver() *noneDriver {
+	return &noneDriver{
+		collections: make(map[string]*collection),
+		seeded:      make(map[*interface{}]bool),
+	}
 }
 
 func (g *noneDriver) ConnectDB(config map[string]string) error {
@@ -35,103 +67,334 @@ func getSliceValue(model interface{}) []interface{} {
 	}
 }
 
-// getItemId returns ID of the item by best guess
-func getItemID(item interface{}) interface{} {
+// collection returns collection of Go type, creating it on first use
+func (g *noneDriver) collection(typ reflect.Type) *collection {
+	name := typeName(typ)
 
-	// If item suports Resources - Use that
-	if r, ok := item.(jsonapi.Resourcer); ok {
-		return r.GetID()
+	c, ok := g.collections[name]
+	if !ok {
+		c = newCollection(typ)
+		g.collections[name] = c
 	}
 
-	v := reflect.ValueOf(item)
+	return c
+}
 
-	// If item is not a struct, then whole object is used as ID
-	if v.Kind() != reflect.Struct {
-		return item
+// scope returns collections served by model. Model is either a prototype of
+// collection item, or a slice of items of one or more types. Items of slice
+// are added to collections when slice is first used.
+func (g *noneDriver) scope(model interface{}) []*collection {
+	switch model.(type) {
+	case []interface{}, *[]interface{}, func() interface{}:
+	default:
+		return []*collection{g.collection(reflect.TypeOf(model))}
 	}
 
-	// If struct item has field ID - use it
-	if value := v.FieldByName("ID"); v.IsValid() {
-		return value.Interface()
+	items := getSliceValue(model)
+	seed := len(items) > 0 && !g.seeded[&items[0]]
+	if seed {
+		g.seeded[&items[0]] = true
 	}
 
-	// If struct item has field Id - use it
-	if value := v.FieldByName("Id"); v.IsValid() {
-		return value.Interface()
-	}
+	result := []*collection{}
+	known := make(map[*collection]bool)
 
-	// Return whole struct as its ID
-	println("No ID:", item)
-	return item
-}
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
 
-// findItem finds id in slice using reflection
-func findItem(slice []interface{}, id interface{}) int {
+		c := g.collection(reflect.TypeOf(item))
+		if !known[c] {
+			known[c] = true
+			result = append(result, c)
+		}
 
-	for i, item := range slice {
-		if getItemID(item) == id {
-			return i
+		if seed {
+			c.put(item)
 		}
 	}
 
-	return -1
+	return result
 }
 
-func (g *noneDriver) FindAll(model interface{}, parentID interface{}, query string) (*jsonapi.DocCollection, error) {
+// prepare returns collections of model, seeding them if needed
+func (g *noneDriver) prepare(model interface{}) []*collection {
 	g.Lock()
 	defer g.Unlock()
 
-	models := getSliceValue(model)
+	return g.scope(model)
+}
+
+// target returns collection for resource type of created resource. If model
+// serves one collection, it is used for any type.
+func target(collections []*collection, typeName string) (*collection, error) {
+	for _, c := range collections {
+		if c.name == typeName {
+			return c, nil
+		}
+	}
+
+	if len(collections) == 1 {
+		return collections[0], nil
+	}
+
+	e := jsonapi.NewErr(http.StatusConflict, "Resource type %q does not match endpoint", typeName)
+	e.Source.Pointer = "/data/type"
+	return nil, e
+}
+
+// prototypes returns zero item of each collection, for model interfaces
+func prototypes(collections []*collection) []interface{} {
+	result := make([]interface{}, len(collections))
+	for i, c := range collections {
+		result[i] = c.prototype()
+	}
+
+	return result
+}
+
+// fieldNames returns attribute names by resource type, using same rules as ToResource
+func fieldNames(models []interface{}) map[string]map[string]bool {
+	known := make(map[string]map[string]bool)
+
+	for _, item := range models {
+		if _, ok := item.(jsonapi.ResourceConvertor); ok {
+			continue
+		}
+
+		typ := reflect.ValueOf(item)
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+
+		kin := typ.Type()
+		if _, ok := known[kin.Name()]; ok {
+			continue
+		}
+
+		names := make(map[string]bool)
+		known[kin.Name()] = names
+
+		if typ.Kind() != reflect.Struct {
+			names["value"] = true
+			continue
+		}
+
+		for i := 0; i < kin.NumField(); i++ {
+			if t := kin.Field(i); !t.Anonymous && (strings.ToUpper(t.Name) != "ID") {
+				names[jsonapi.LowerInitial(t.Name)] = true
+			}
+		}
+	}
+
+	return known
+}
+
+// sortable returns attribute names of all models in slice
+func sortable(models []interface{}) map[string]bool {
+	allowed := make(map[string]bool)
+
+	for _, names := range fieldNames(models) {
+		for name := range names {
+			allowed[name] = true
+		}
+	}
+
+	return allowed
+}
 
-	collection := make([]*jsonapi.Resource, len(models))
-	includes := jsonapi.NewIncludes()
+// limit returns n, but not more than max
+func limit(n, max int) int {
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// checkIncludes rejects include paths, since only models with
+// own ResourceConvertor can have relationships
+func checkIncludes(models []interface{}, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	for _, item := range models {
+		if _, ok := item.(jsonapi.ResourceConvertor); !ok {
+			return jsonapi.ErrParameter("include", "Unknown relationship path %q", paths[0])
+		}
+	}
+
+	return nil
+}
+
+// FindAll returns items of model collections. Collections are not
+// limited by parentID.
+func (g *noneDriver) FindAll(model interface{}, parentID interface{}, query *jsonapi.Query) (*jsonapi.DocCollection, error) {
+	collections := g.prepare(model)
+
+	g.RLock()
+	defer g.RUnlock()
+
+	protos := prototypes(collections)
+
+	if err := query.Fields.Check(fieldNames(protos)); err != nil {
+		return nil, err
+	}
+
+	if err := checkIncludes(protos, query.Include); err != nil {
+		return nil, err
+	}
+
+	allowed := sortable(protos)
+
+	if len(protos) > 0 {
+		if err := jsonapi.CheckSort(protos[0], query.Sort, allowed); err != nil {
+			return nil, err
+		}
+	}
+
+	// filter[name]=value, and filter[id][in]=1,2
+	var proto interface{}
+	if len(protos) > 0 {
+		proto = protos[0]
+	}
+
+	if err := jsonapi.CheckFilters(proto, query.Filters, allowed); err != nil {
+		return nil, err
+	}
+
+	if err := query.Page.Check(jsonapi.OffsetPagination); err != nil {
+		return nil, err
+	}
+
+	models := []interface{}{}
+	for _, c := range collections {
+		models = append(models, c.items...)
+	}
+
+	// Filter and sort all models by their attributes, and convert only page with includes
+	all := make([]*jsonapi.Resource, len(models))
+	index := make(map[*jsonapi.Resource]int, len(models))
+
+	for i := range all {
+		all[i] = g.ToResource(models[i], jsonapi.NewIncludes())
+		index[all[i]] = i
+	}
+
+	all, err := jsonapi.FilterResources(all, query.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonapi.SortResources(all, query.Sort)
+
+	total := len(all)
+	all = all[limit(query.Page.Offset(), total):limit(query.Page.Offset()+query.Page.Size, total)]
+
+	collection := make([]*jsonapi.Resource, len(all))
+	includes := jsonapi.NewIncludes(query.Include...)
 
 	for i := range collection {
-		collection[i] = g.ToResource(models[i], includes)
+		collection[i] = g.ToResource(models[index[all[i]]], includes)
 	}
 
-	return &jsonapi.DocCollection{
+	included := includes.ToArray()
+	query.Fields.Apply(collection...)
+	query.Fields.Apply(included...)
+
+	result := &jsonapi.DocCollection{
 		Data:     collection,
-		Included: includes.ToArray(),
+		Included: included,
 		JSONApi:  &jsonapi.VersionMeta{Version: "1.0"},
-	}, nil
+	}
+	result.Paginate(query, total)
+
+	return result, nil
 }
 
-func (g *noneDriver) FindRecord(model, id interface{}, query string) (*jsonapi.DocItem, error) {
-	g.Lock()
-	defer g.Unlock()
+func (g *noneDriver) FindRecord(model, id interface{}, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	collections := g.prepare(model)
 
-	includes := jsonapi.NewIncludes()
-	item := g.ToResource(model, includes)
+	g.RLock()
+	defer g.RUnlock()
 
-	return &jsonapi.DocItem{
-		Data:     item,
-		Included: includes.ToArray(),
-		JSONApi:  &jsonapi.VersionMeta{Version: "1.0"},
-	}, nil
+	return g.findRecord(collections, fmt.Sprintf("%v", id), query)
+}
+
+func (g *noneDriver) findRecord(collections []*collection, id string, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	protos := prototypes(collections)
+
+	if err := query.Fields.Check(fieldNames(protos)); err != nil {
+		return nil, err
+	}
+
+	if err := checkIncludes(protos, query.Include); err != nil {
+		return nil, err
+	}
+
+	for _, c := range collections {
+		model, ok := c.find(id)
+		if !ok {
+			continue
+		}
+
+		includes := jsonapi.NewIncludes(query.Include...)
+		item := g.ToResource(model, includes)
+
+		included := includes.ToArray()
+		query.Fields.Apply(item)
+		query.Fields.Apply(included...)
+
+		return &jsonapi.DocItem{
+			Data:     item,
+			Included: included,
+			JSONApi:  &jsonapi.VersionMeta{Version: "1.0"},
+		}, nil
+	}
+
+	return nil, jsonapi.ErrNotFound
 }
 
 func (g *noneDriver) Delete(model interface{}, id interface{}) error {
 	g.Lock()
 	defer g.Unlock()
 
-	models := getSliceValue(model)
-	if idx := findItem(models, id); idx >= 0 {
-		copy(models[idx:], models[idx+1:])
-		models[len(models)-1] = nil // or the zero value of T
-		models = models[:len(models)-1]
+	for _, c := range g.scope(model) {
+		if c.remove(fmt.Sprintf("%v", id)) {
+			return nil
+		}
 	}
 
-	return nil
+	return jsonapi.ErrNotFound
 }
 
 func (g *noneDriver) Update(model interface{}, id interface{}, doc *jsonapi.DocItem) error {
 	g.Lock()
 	defer g.Unlock()
 
-	models := getSliceValue(model)
-	if idx := findItem(models, id); idx >= 0 {
+	key := fmt.Sprintf("%v", id)
 
+	for _, c := range g.scope(model) {
+		item, ok := c.find(key)
+		if !ok {
+			continue
+		}
+
+		updated, err := c.build(item, "", doc.Data)
+		if err != nil {
+			return err
+		}
+
+		// Id of non-struct item is its value
+		if newID := itemID(updated); newID != key {
+			if _, exists := c.find(newID); exists {
+				return jsonapi.ErrAttribute("value", "Resource with id %q already exists", newID)
+			}
+		}
+
+		c.replace(key, updated)
+		return nil
 	}
 
 	return jsonapi.ErrNotFound
@@ -141,18 +404,104 @@ func (g *noneDriver) Create(model interface{}, doc *jsonapi.DocItem) (*jsonapi.D
 	g.Lock()
 	defer g.Unlock()
 
-	// If there is Id, user cen return "204 Ok - No Content", or retreive record by id
-	if doc.Data.ID != "" {
-		doc.Data.Attributes["id"] = doc.Data.ID
-		return nil, nil
+	collections := g.scope(model)
+
+	c, err := target(collections, doc.Data.Type)
+	if err != nil {
+		return nil, err
 	}
 
-	//append(getSliceValue(model), model)
+	// Client-generated id is used as it is, else id is generated
+	id := doc.Data.ID
+	if id == "" {
+		if id, err = c.newID(); err != nil {
+			return nil, err
+		}
+	}
 
-	return doc, nil
+	item, err := c.build(nil, id, doc.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, exists := c.find(itemID(item)); exists {
+		e := jsonapi.NewErr(http.StatusConflict, "Resource with id %q already exists", itemID(item))
+		e.Source.Pointer = "/data/id"
+		return nil, e
+	}
+
+	c.put(item)
+
+	return g.findRecord([]*collection{c}, itemID(item), jsonapi.NewQuery())
+}
+
+// Transaction runs fn with driver working on same collections. If fn returns
+// error, collections are restored to state before transaction.
+func (g *noneDriver) Transaction(fn func(db jsonapi.Database) error) error {
+	g.Lock()
+	defer g.Unlock()
+
+	collections := make(map[string]*collection, len(g.collections))
+	for name, c := range g.collections {
+		collections[name] = c.clone()
+	}
+
+	seeded := make(map[*interface{}]bool, len(g.seeded))
+	for first := range g.seeded {
+		seeded[first] = true
+	}
+
+	if err := fn(&noneDriver{collections: g.collections, seeded: g.seeded}); err != nil {
+		g.collections, g.seeded = collections, seeded
+		return err
+	}
+
+	return nil
+}
+
+// Load replaces items of model collection with resources
+func (g *noneDriver) Load(model interface{}, resources []*jsonapi.Resource) error {
+	g.Lock()
+	defer g.Unlock()
+
+	c := g.collection(reflect.TypeOf(model))
+	loaded := newCollection(c.typ)
+
+	for _, resource := range resources {
+		item, err := loaded.build(nil, resource.ID, resource)
+		if err != nil {
+			return err
+		}
+
+		loaded.put(item)
+	}
+
+	*c = *loaded
+	return nil
+}
+
+// Dump returns items of model collection as resources
+func (g *noneDriver) Dump(model interface{}) []*jsonapi.Resource {
+	g.Lock()
+	defer g.Unlock()
+
+	c := g.collection(reflect.TypeOf(model))
+	result := make([]*jsonapi.Resource, len(c.items))
+
+	for i, item := range c.items {
+		result[i] = toResource(item, jsonapi.NewIncludes())
+	}
+
+	return result
 }
 
 func (g *noneDriver) ToResource(value interface{}, includes *jsonapi.Includes) *jsonapi.Resource {
+	return toResource(value, includes)
+}
+
+// toResource converts item to resource. Struct fields are attributes,
+// except ID field, and non-struct item is its own id and value attribute.
+func toResource(value interface{}, includes *jsonapi.Includes) *jsonapi.Resource {
 
 	// Use ApiConvertor interface if there is one
 	if convertor, implements := value.(jsonapi.ResourceConvertor); implements {
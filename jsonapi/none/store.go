@@ -0,0 +1,271 @@
+package none
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dmajkic/ibis/jsonapi"
+)
+
+// collection holds items of one Go type, in order they were added.
+// Items are stored as values of typ, either structs or pointers to structs.
+type collection struct {
+	name  string
+	typ   reflect.Type
+	items []interface{}
+	index map[string]int
+
+	// last is largest integer id, for autoincrement ids
+	last int64
+}
+
+func newCollection(typ reflect.Type) *collection {
+	return &collection{
+		name:  typeName(typ),
+		typ:   typ,
+		index: make(map[string]int),
+	}
+}
+
+// typeName returns resource type of Go type, same as in ToResource
+func typeName(typ reflect.Type) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	return typ.Name()
+}
+
+// itemID returns resource id of item
+func itemID(item interface{}) string {
+	return toResource(item, jsonapi.NewIncludes()).ID
+}
+
+// prototype returns zero value of collection type, for model interfaces
+func (c *collection) prototype() interface{} {
+	if c.typ.Kind() == reflect.Ptr {
+		return reflect.New(c.typ.Elem()).Interface()
+	}
+
+	return reflect.Zero(c.typ).Interface()
+}
+
+func (c *collection) find(id string) (interface{}, bool) {
+	i, ok := c.index[id]
+	if !ok {
+		return nil, false
+	}
+
+	return c.items[i], true
+}
+
+// put adds item, or replaces item with same id
+func (c *collection) put(item interface{}) {
+	id := itemID(item)
+
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil && n > c.last {
+		c.last = n
+	}
+
+	if i, ok := c.index[id]; ok {
+		c.items[i] = item
+		return
+	}
+
+	c.index[id] = len(c.items)
+	c.items = append(c.items, item)
+}
+
+// replace replaces item with id, that can be changed by update
+func (c *collection) replace(id string, item interface{}) {
+	i := c.index[id]
+	delete(c.index, id)
+
+	c.items[i] = item
+	c.index[itemID(item)] = i
+}
+
+func (c *collection) remove(id string) bool {
+	i, ok := c.index[id]
+	if !ok {
+		return false
+	}
+
+	copy(c.items[i:], c.items[i+1:])
+	c.items[len(c.items)-1] = nil
+	c.items = c.items[:len(c.items)-1]
+
+	delete(c.index, id)
+	for j := i; j < len(c.items); j++ {
+		c.index[itemID(c.items[j])] = j
+	}
+
+	return true
+}
+
+// clone returns copy of collection, for rollback of transaction.
+// Items are not changed in place, so they are shared.
+func (c *collection) clone() *collection {
+	result := *c
+	result.items = append([]interface{}(nil), c.items...)
+	result.index = make(map[string]int, len(c.index))
+	for id, i := range c.index {
+		result.index[id] = i
+	}
+
+	return &result
+}
+
+// newID returns id for new item, from IDGenerator of resource options.
+// Integer ids are autoincremented by default, others are UUIDs.
+func (c *collection) newID() (string, error) {
+	fallback := jsonapi.UUIDv4
+	if field, ok := idField(c.typ); ok && isInteger(field.Type) {
+		fallback = jsonapi.AutoIncrement
+	}
+
+	id, err := jsonapi.NewID(c.prototype(), fallback)
+	if err != nil || id != "" {
+		return id, err
+	}
+
+	return strconv.FormatInt(c.last+1, 10), nil
+}
+
+// idField returns id field of struct type, as recognized by ToResource
+func idField(typ reflect.Type) (reflect.StructField, bool) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		if f := typ.Field(i); !f.Anonymous && strings.ToUpper(f.Name) == "ID" {
+			return f, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func isInteger(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+// build returns item with attributes of resource applied to base item.
+// Base is zero value for new items. Id is set only if it is not empty.
+func (c *collection) build(base interface{}, id string, resource *jsonapi.Resource) (interface{}, error) {
+	for name := range resource.Relationships {
+		e := jsonapi.NewErr(http.StatusUnprocessableEntity, "Unknown relationship %q", name)
+		e.Source.Pointer = "/data/relationships/" + name
+		return nil, e
+	}
+
+	elem := c.typ
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	value := reflect.New(elem).Elem()
+	if base != nil {
+		value.Set(reflect.Indirect(reflect.ValueOf(base)))
+	}
+
+	names := make([]string, 0, len(resource.Attributes))
+	for name := range resource.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := jsonapi.Errors{}
+
+	if value.Kind() != reflect.Struct {
+		// Value of non-struct item is its attribute and its id
+		for _, name := range names {
+			if name != "value" {
+				errs = append(errs, jsonapi.ErrAttribute(name, "Unknown attribute %q", name))
+				continue
+			}
+
+			v, err := jsonapi.DecodeValue(elem, resource.Attributes[name])
+			if err != nil {
+				errs = append(errs, jsonapi.ErrAttribute(name, "%v", err))
+				continue
+			}
+			value.Set(v)
+		}
+	} else {
+		fields := make(map[string]int, elem.NumField())
+		for i := 0; i < elem.NumField(); i++ {
+			if f := elem.Field(i); !f.Anonymous && strings.ToUpper(f.Name) != "ID" && f.PkgPath == "" {
+				fields[jsonapi.LowerInitial(f.Name)] = i
+			}
+		}
+
+		for _, name := range names {
+			i, ok := fields[name]
+			if !ok {
+				errs = append(errs, jsonapi.ErrAttribute(name, "Unknown attribute %q", name))
+				continue
+			}
+
+			v, err := jsonapi.DecodeValue(elem.Field(i).Type, resource.Attributes[name])
+			if err != nil {
+				errs = append(errs, jsonapi.ErrAttribute(name, "%v", err))
+				continue
+			}
+			value.Field(i).Set(v)
+		}
+
+		if id != "" {
+			if err := setID(value, id); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if c.typ.Kind() == reflect.Ptr {
+		return value.Addr().Interface(), nil
+	}
+
+	return value.Interface(), nil
+}
+
+// setID sets id field of struct value, converting id to field type
+func setID(value reflect.Value, id string) error {
+	field, ok := idField(value.Type())
+	if !ok {
+		return jsonapi.NewErr(http.StatusInternalServerError, "Model %v has no ID field", value.Type().Name())
+	}
+
+	v, err := jsonapi.ParseValue(field.Type, id)
+	if err != nil {
+		e := jsonapi.NewErr(http.StatusUnprocessableEntity, "Invalid id: %v", err)
+		e.Source.Pointer = "/data/id"
+		return e
+	}
+
+	rv := reflect.ValueOf(v)
+	if !rv.Type().ConvertibleTo(field.Type) {
+		return jsonapi.NewErr(http.StatusInternalServerError, "Unsupported ID type %v", field.Type)
+	}
+
+	value.FieldByIndex(field.Index).Set(rv.Convert(field.Type))
+	return nil
+}
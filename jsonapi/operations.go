@@ -0,0 +1,97 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// AtomicExtension is URI of JSONAPI Atomic Operations extension
+const AtomicExtension = "https://jsonapi.org/ext/atomic"
+
+// Operation codes of Atomic Operations extension
+const (
+	OpAdd    = "add"
+	OpUpdate = "update"
+	OpRemove = "remove"
+)
+
+// OperationRef identifies resource, or relationship of resource, that operation targets
+type OperationRef struct {
+	Type         string `json:"type"`
+	ID           string `json:"id,omitempty"`
+	Lid          string `json:"lid,omitempty"`
+	Relationship string `json:"relationship,omitempty"`
+}
+
+// Operation represents single operation of Atomic Operations request.
+// Data is resource object, or resource linkage if Ref targets relationship.
+type Operation struct {
+	Op   string                 `json:"op"`
+	Ref  *OperationRef          `json:"ref,omitempty"`
+	Href string                 `json:"href,omitempty"`
+	Data json.RawMessage        `json:"data,omitempty"`
+	Meta map[string]interface{} `json:"meta,omitempty"`
+}
+
+// DocOperations represents Atomic Operations request document
+type DocOperations struct {
+	Operations []Operation            `json:"atomic:operations"`
+	Meta       map[string]interface{} `json:"meta,omitempty"`
+	JSONApi    *VersionMeta           `json:"jsonapi,omitempty"`
+}
+
+// OperationResult represents result of single operation.
+// Data is nil if operation does not return resource.
+type OperationResult struct {
+	Data *Resource              `json:"data,omitempty"`
+	Meta map[string]interface{} `json:"meta,omitempty"`
+}
+
+// DocResults represents Atomic Operations response document
+type DocResults struct {
+	Results []OperationResult      `json:"atomic:results"`
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+	JSONApi *VersionMeta           `json:"jsonapi,omitempty"`
+}
+
+// LocalIDs maps local ids (lid) of resources created in Atomic Operations
+// request to ids assigned by server
+type LocalIDs map[string]string
+
+// Set records server id of resource created with local id
+func (l LocalIDs) Set(typeName, lid, id string) {
+	l[typeName+"/"+lid] = id
+}
+
+// Get returns server id of resource created with local id
+func (l LocalIDs) Get(typeName, lid string) (string, bool) {
+	id, ok := l[typeName+"/"+lid]
+	return id, ok
+}
+
+// Resolve replaces local ids in resource linkage with server ids.
+// "400 Bad Request" is returned for local id that is not assigned, with pointer to linkage.
+func (l LocalIDs) Resolve(data *RelationshipData, pointer string) error {
+	for i := range data.ResourceIds {
+		rid := &data.ResourceIds[i]
+		if rid.ID != "" || rid.Lid == "" {
+			continue
+		}
+
+		id, ok := l.Get(rid.Type, rid.Lid)
+		if !ok {
+			e := NewErr(http.StatusBadRequest, "Unknown local id %q of %v resource", rid.Lid, rid.Type)
+			e.Source.Pointer = pointer + "/lid"
+			if !data.IsSingle {
+				e.Source.Pointer = pointer + "/" + strconv.Itoa(i) + "/lid"
+			}
+			return e
+		}
+
+		rid.ID = id
+		rid.Lid = ""
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package jsonapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sync"
+)
+
+// Pagination is pagination mode of resource collection
+type Pagination int
+
+const (
+	// OffsetPagination uses page[number] and page[size]
+	OffsetPagination Pagination = iota
+	// CursorPagination uses page[after], page[before] and page[size]
+	CursorPagination
+)
+
+// UUIDFormat matches UUIDs in canonical form, for ResourceOptions.ClientIDFormat
+var UUIDFormat = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ResourceOptions are per resource settings, set when resource is registered.
+// Drivers look them up by model type.
+type ResourceOptions struct {
+	Pagination Pagination
+
+	// ClientIDs allows client-generated ids on create. If ClientIDFormat
+	// is set, client-generated ids must match it.
+	ClientIDs      bool
+	ClientIDFormat *regexp.Regexp
+
+	// IDGenerator creates ids of resources created without client-generated
+	// id. If it is not set, driver chooses one by primary key type.
+	IDGenerator IDGenerator
+}
+
+var resourceOptions = struct {
+	sync.RWMutex
+	m map[reflect.Type]ResourceOptions
+}{m: make(map[reflect.Type]ResourceOptions)}
+
+func modelType(model interface{}) reflect.Type {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// SetResourceOptions sets options for model type
+func SetResourceOptions(model interface{}, options ResourceOptions) {
+	resourceOptions.Lock()
+	defer resourceOptions.Unlock()
+
+	resourceOptions.m[modelType(model)] = options
+}
+
+// GetResourceOptions returns options for model type, or default options if none are set
+func GetResourceOptions(model interface{}) ResourceOptions {
+	resourceOptions.RLock()
+	defer resourceOptions.RUnlock()
+
+	return resourceOptions.m[modelType(model)]
+}
+
+// NewID returns new id of model resource, created by IDGenerator set in
+// resource options, or by fallback generator of driver
+func NewID(model interface{}, fallback IDGenerator) (string, error) {
+	generator := GetResourceOptions(model).IDGenerator
+	if generator == nil {
+		generator = fallback
+	}
+
+	return generator.NewID()
+}
+
+// CheckClientID checks client-generated id of created resource. "403 Forbidden"
+// is returned if model does not allow client-generated ids, and "422 Unprocessable
+// Entity" if id does not match ClientIDFormat.
+func CheckClientID(model interface{}, id string) error {
+	if id == "" {
+		return nil
+	}
+
+	options := GetResourceOptions(model)
+	if !options.ClientIDs {
+		e := NewErr(http.StatusForbidden, "Client-generated ids are not supported")
+		e.Source.Pointer = "/data/id"
+		return e
+	}
+
+	if options.ClientIDFormat != nil && !options.ClientIDFormat.MatchString(id) {
+		e := NewErr(http.StatusUnprocessableEntity, "Invalid format of id %q", id)
+		e.Source.Pointer = "/data/id"
+		return e
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package jsonapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+var (
+	// DefaultPageSize is used when client does not request page[size]
+	DefaultPageSize = 20
+	// MaxPageSize limits page[size] that client can request
+	MaxPageSize = 100
+)
+
+// Page represents page[number], page[size], page[after] and page[before]
+// query parameters. Number is zero if it is not requested. After and
+// Before are opaque cursors of cursor (keyset) pagination.
+type Page struct {
+	Number int
+	Size   int
+	After  string
+	Before string
+}
+
+// ParsePage extracts pagination from query values.
+// Page size is limited to MaxPageSize.
+func ParsePage(values url.Values) (Page, error) {
+	page := Page{
+		Size:   DefaultPageSize,
+		After:  values.Get("page[after]"),
+		Before: values.Get("page[before]"),
+	}
+
+	for _, param := range []string{"page[number]", "page[size]"} {
+		value := values.Get(param)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return page, ErrParameter(param, "Expected positive integer for %v", param)
+		}
+
+		if param == "page[number]" {
+			page.Number = n
+		} else {
+			page.Size = n
+		}
+	}
+
+	if page.After != "" && page.Before != "" {
+		return page, ErrParameter("page[before]", "Only one of page[after] and page[before] can be used")
+	}
+
+	if page.Number > 0 && (page.After != "" || page.Before != "") {
+		return page, ErrParameter("page[number]", "page[number] can not be used with page[after] or page[before]")
+	}
+
+	if page.Size > MaxPageSize {
+		page.Size = MaxPageSize
+	}
+
+	return page, nil
+}
+
+// Check returns "400 Bad Request" error if page parameters
+// do not match pagination mode of collection
+func (p Page) Check(mode Pagination) error {
+	if mode == CursorPagination && p.Number > 0 {
+		return ErrParameter("page[number]", "Collection uses cursor pagination")
+	}
+
+	if mode == OffsetPagination && p.After != "" {
+		return ErrParameter("page[after]", "Collection uses page[number] pagination")
+	}
+
+	if mode == OffsetPagination && p.Before != "" {
+		return ErrParameter("page[before]", "Collection uses page[number] pagination")
+	}
+
+	return nil
+}
+
+// Offset returns number of records before page
+func (p Page) Offset() int {
+	if p.Number < 1 {
+		return 0
+	}
+
+	return (p.Number - 1) * p.Size
+}
+
+// Pages returns number of pages for total number of records
+func (p Page) Pages(total int) int {
+	return (total + p.Size - 1) / p.Size
+}
+
+// link returns query-only link with page parameters replaced, keeping other query parameters
+func (p Page) link(values url.Values, param, value string) string {
+	query := url.Values{}
+	for key, value := range values {
+		query[key] = value
+	}
+
+	query.Del("page[number]")
+	query.Del("page[after]")
+	query.Del("page[before]")
+	query.Set(param, value)
+	query.Set("page[size]", strconv.Itoa(p.Size))
+
+	return "?" + query.Encode()
+}
+
+// Paginate sets pagination links and meta.total/meta.pages on collection.
+// Links are relative to request URL and should be resolved with Links.Resolve.
+func (d *DocCollection) Paginate(query *Query, total int) {
+	page := query.Page
+	number := page.Number
+	if number < 1 {
+		number = 1
+	}
+
+	pages := page.Pages(total)
+
+	if d.Links == nil {
+		d.Links = &Links{}
+	}
+
+	d.Links.Self = page.link(query.Values, "page[number]", strconv.Itoa(number))
+	d.Links.First = page.link(query.Values, "page[number]", "1")
+	d.Links.Last = d.Links.First
+
+	if pages > 1 {
+		d.Links.Last = page.link(query.Values, "page[number]", strconv.Itoa(pages))
+	}
+
+	if number > 1 {
+		d.Links.Prev = page.link(query.Values, "page[number]", strconv.Itoa(number-1))
+	}
+
+	if number < pages {
+		d.Links.Next = page.link(query.Values, "page[number]", strconv.Itoa(number+1))
+	}
+
+	if d.Meta == nil {
+		d.Meta = make(map[string]interface{})
+	}
+
+	d.Meta["total"] = total
+	d.Meta["pages"] = pages
+}
+
+// PaginateCursor sets prev and next links on collection, from cursors of
+// first and last resource. Empty cursor means there is no such page.
+func (d *DocCollection) PaginateCursor(query *Query, prev, next string) {
+	if d.Links == nil {
+		d.Links = &Links{}
+	}
+
+	if prev != "" {
+		d.Links.Prev = query.Page.link(query.Values, "page[before]", prev)
+	}
+
+	if next != "" {
+		d.Links.Next = query.Page.link(query.Values, "page[after]", next)
+	}
+}
+
+// Resolve makes links absolute, using base as request URL
+func (l *Links) Resolve(base *url.URL) {
+	for _, link := range []*string{&l.Self, &l.Related, &l.First, &l.Last, &l.Prev, &l.Next} {
+		if *link == "" {
+			continue
+		}
+
+		if ref, err := url.Parse(*link); err == nil {
+			*link = base.ResolveReference(ref).String()
+		}
+	}
+}
+
+// EncodeCursor encodes key values of resource to opaque cursor
+func EncodeCursor(keys ...interface{}) (string, error) {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor decodes cursor from query parameter param to raw key values
+func DecodeCursor(param, cursor string, count int) ([]json.RawMessage, error) {
+	var keys []json.RawMessage
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &keys)
+	}
+
+	if err != nil || len(keys) != count {
+		return nil, ErrParameter(param, "Invalid cursor")
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,121 @@
+package jsonapi
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Query is parsed JSONAPI request query, passed to Database drivers.
+// Drivers check it against model, ie. that fields and sort keys exist.
+type Query struct {
+	Include []string
+	Fields  Fieldsets
+	Sort    []SortField
+	Page    Page
+	Filters []Filter
+
+	// Values are original query values, used to build links
+	Values url.Values
+}
+
+// RenameID returns copy of query, with sort keys and filters on "id" renamed
+// to name, ie. to primary key column for drivers that sort and filter in database
+func (q *Query) RenameID(name string) *Query {
+	result := *q
+
+	result.Sort = make([]SortField, len(q.Sort))
+	for i, field := range q.Sort {
+		if field.Name == "id" {
+			field.Name = name
+		}
+		result.Sort[i] = field
+	}
+
+	result.Filters = make([]Filter, len(q.Filters))
+	for i, filter := range q.Filters {
+		if filter.Name == "id" {
+			filter.Name = name
+		}
+		result.Filters[i] = filter
+	}
+
+	return &result
+}
+
+var pageParams = map[string]bool{
+	"page[number]": true,
+	"page[size]":   true,
+	"page[after]":  true,
+	"page[before]": true,
+}
+
+// NewQuery creates Query with default values, as if query string is empty
+func NewQuery() *Query {
+	return &Query{
+		Include: []string{},
+		Fields:  Fieldsets{},
+		Sort:    []SortField{},
+		Page:    Page{Size: DefaultPageSize},
+		Filters: []Filter{},
+		Values:  url.Values{},
+	}
+}
+
+// ParseQuery parses include, fields, sort, page and filter query parameters.
+// Other parameters must be implementation specific, with at least one
+// character outside a-z, or listed in params; "400 Bad Request" is returned otherwise.
+func ParseQuery(values url.Values, params ...string) (*Query, error) {
+	var err error
+
+	query := NewQuery()
+	query.Values = values
+
+	for key := range values {
+		if err := checkParameter(key, params); err != nil {
+			return nil, err
+		}
+	}
+
+	query.Include = ParseIncludes(values)
+	query.Fields = ParseFieldsets(values)
+	query.Sort = ParseSort(values)
+
+	if query.Page, err = ParsePage(values); err != nil {
+		return nil, err
+	}
+
+	if query.Filters, err = ParseFilters(values); err != nil {
+		return nil, err
+	}
+
+	return query, nil
+}
+
+// checkParameter validates query parameter name
+func checkParameter(key string, params []string) error {
+	switch {
+	case key == "include" || key == "sort":
+		return nil
+	case strings.HasPrefix(key, "fields[") || strings.HasPrefix(key, "filter["):
+		return nil
+	case key == "filter":
+		return ErrParameter(key, "Expected filter[name] or filter[name][op]")
+	case strings.HasPrefix(key, "page["):
+		if !pageParams[key] {
+			return ErrParameter(key, "Unsupported pagination parameter %v", key)
+		}
+		return nil
+	}
+
+	for _, param := range params {
+		if key == param {
+			return nil
+		}
+	}
+
+	if strings.Trim(key, "abcdefghijklmnopqrstuvwxyz") == "" {
+		return ErrParameter(key, "Unsupported query parameter %v", key)
+	}
+
+	return nil
+}
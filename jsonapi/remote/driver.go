@@ -0,0 +1,377 @@
+// Package remote implements JSONAPI database that forwards calls to other
+// JSONAPI server, so one service can expose resources of another. Query
+// parameters are passed as they are, with headers of client request, and
+// collections are limited to parent with filter of Scoper models.
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmajkic/ibis/jsonapi"
+	"github.com/dmajkic/ibis/jsonapi/none"
+)
+
+var (
+	// Timeout limits each request to remote server
+	Timeout = 30 * time.Second
+
+	// ForwardHeaders are headers of client request passed to remote server
+	ForwardHeaders = []string{"Authorization", "X-Request-ID", "Accept-Language"}
+)
+
+// Endpointer is implemented by models served by remote endpoint other than
+// lowercase plural of type name, ie. "blog-posts" for BlogPost
+type Endpointer interface {
+	Endpoint() string
+}
+
+// Scoper is implemented by models that belong to parent resource. ParentFilter
+// returns filter that remote server limits collection with, ie. "user_id", and
+// FindAll sends parent id as filter[user_id]. Collections of other models can
+// not be limited to parent, and FindAll fails if parent id is set.
+type Scoper interface {
+	ParentFilter() string
+}
+
+type remoteDriver struct {
+	sync.RWMutex
+
+	base   *url.URL
+	client *http.Client
+
+	// header holds forwarded headers of client request
+	header http.Header
+}
+
+// local converts models to resources, same as none driver
+var local = none.NewStore()
+
+func init() {
+	jsonapi.RegisterDriver("remote", &remoteDriver{})
+}
+
+// ConnectDB sets base URL of remote server from dbUrl, ie. "https://api.example.com/v1"
+func (d *remoteDriver) ConnectDB(config map[string]string) error {
+	base, err := url.Parse(config["dbUrl"])
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return errors.New("Missing remote server URL in DbURL")
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.base = base
+	d.client = &http.Client{Timeout: Timeout}
+
+	return nil
+}
+
+// connected returns copy of driver, or error if it is not connected
+func (d *remoteDriver) connected() (*remoteDriver, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	if d.base == nil {
+		return nil, errors.New("Remote database is not connected")
+	}
+
+	return &remoteDriver{base: d.base, client: d.client, header: d.header}, nil
+}
+
+// WithRequest returns driver that passes ForwardHeaders of client request to remote server
+func (d *remoteDriver) WithRequest(request *http.Request) jsonapi.Database {
+	d.RLock()
+	defer d.RUnlock()
+
+	header := http.Header{}
+	for _, name := range ForwardHeaders {
+		name = http.CanonicalHeaderKey(name)
+		if values, ok := request.Header[name]; ok {
+			header[name] = values
+		}
+	}
+
+	return &remoteDriver{base: d.base, client: d.client, header: header}
+}
+
+// endpoint returns URL of model collection, or of resource if id is not nil
+func (d *remoteDriver) endpoint(model interface{}, id interface{}, values url.Values) string {
+	var path string
+
+	if endpointer, ok := model.(Endpointer); ok {
+		path = endpointer.Endpoint()
+	} else {
+		typ := reflect.TypeOf(model)
+		for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+			typ = typ.Elem()
+		}
+		path = strings.ToLower(typ.Name()) + "s"
+	}
+
+	u := *d.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.Trim(path, "/")
+	u.RawPath = ""
+
+	if id != nil {
+		escaped := u.EscapedPath() + "/" + url.PathEscape(fmt.Sprintf("%v", id))
+		u.Path += "/" + fmt.Sprintf("%v", id)
+		u.RawPath = escaped
+	}
+
+	u.RawQuery = values.Encode()
+	return u.String()
+}
+
+// do sends document to remote server, and decodes response document to result.
+// Error documents are returned as jsonapi.Err or jsonapi.Errors, with "404 Not
+// Found" as ErrNotFound.
+func (d *remoteDriver) do(method, endpoint string, doc interface{}, result interface{}) (int, error) {
+	var body io.Reader
+	if doc != nil {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return 0, err
+	}
+
+	for name, values := range d.header {
+		request.Header[name] = values
+	}
+
+	request.Header.Set("Accept", jsonapi.MediaType)
+	if doc != nil {
+		request.Header.Set("Content-Type", jsonapi.MediaType)
+	}
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, remoteError(method, endpoint, err)
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return 0, remoteError(method, endpoint, err)
+	}
+
+	if response.StatusCode >= 300 {
+		return response.StatusCode, errorDocument(response.StatusCode, data)
+	}
+
+	if result != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, result); err != nil {
+			return 0, remoteError(method, endpoint, err)
+		}
+	}
+
+	return response.StatusCode, nil
+}
+
+// remoteError logs error of request to remote server, and returns "502 Bad Gateway"
+func remoteError(method, endpoint string, err error) error {
+	log.Printf("Remote database: %v %v: %v", method, endpoint, err)
+
+	return jsonapi.NewErr(http.StatusBadGateway, "Remote service is not available")
+}
+
+// errorDocument converts errors of remote error document to jsonapi errors.
+// Errors without status get status of response.
+func errorDocument(status int, data []byte) error {
+	if status == http.StatusNotFound {
+		return jsonapi.ErrNotFound
+	}
+
+	doc := &jsonapi.DocItem{}
+	if err := json.Unmarshal(data, doc); err != nil || len(doc.Errors) == 0 {
+		return jsonapi.NewErr(status, "Remote service returned %v", http.StatusText(status))
+	}
+
+	errs := make(jsonapi.Errors, len(doc.Errors))
+	for i := range doc.Errors {
+		e := doc.Errors[i]
+		if e.Status == "" {
+			e.Status = strconv.Itoa(status)
+		}
+		errs[i] = &e
+	}
+
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	return errs
+}
+
+// values returns query values of query, that can be nil
+func values(query *jsonapi.Query) url.Values {
+	if query == nil || query.Values == nil {
+		return url.Values{}
+	}
+
+	return query.Values
+}
+
+// parentValues returns copy of query values with filter of parent id. If model
+// is not Scoper, error is returned instead of collection of all parents.
+func parentValues(model, parentID interface{}, values url.Values) (url.Values, error) {
+	if parentID == nil || fmt.Sprintf("%v", parentID) == "" {
+		return values, nil
+	}
+
+	scoper, ok := model.(Scoper)
+	if !ok {
+		log.Printf("Remote database: %T does not implement Scoper, parent id %v is not sent", model, parentID)
+		return nil, jsonapi.NewErr(http.StatusInternalServerError, "Collection can not be limited to parent")
+	}
+
+	result := url.Values{}
+	for name, value := range values {
+		result[name] = value
+	}
+	result.Set("filter["+scoper.ParentFilter()+"]", fmt.Sprintf("%v", parentID))
+
+	return result, nil
+}
+
+// relative makes links of remote server relative to request URL, so that
+// handlers resolve them as links of this server
+func relative(links *jsonapi.Links) {
+	if links == nil {
+		return
+	}
+
+	for _, link := range []*string{&links.Self, &links.First, &links.Last, &links.Prev, &links.Next} {
+		if u, err := url.Parse(*link); err == nil && *link != "" {
+			*link = "?" + u.RawQuery
+		}
+	}
+	links.Related = ""
+}
+
+// unlink removes links of resources, that point to remote server
+func unlink(resources ...*jsonapi.Resource) {
+	for _, resource := range resources {
+		if resource != nil {
+			resource.Links = nil
+		}
+	}
+}
+
+// FindAll returns collection of remote endpoint, limited to parentID
+// with filter of Scoper
+func (d *remoteDriver) FindAll(model interface{}, parentID interface{}, query *jsonapi.Query) (*jsonapi.DocCollection, error) {
+	c, err := d.connected()
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := parentValues(model, parentID, values(query))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &jsonapi.DocCollection{}
+	if _, err := c.do("GET", c.endpoint(model, nil, params), nil, result); err != nil {
+		return nil, err
+	}
+
+	if result.Data == nil {
+		result.Data = []*jsonapi.Resource{}
+	}
+
+	relative(result.Links)
+	unlink(result.Data...)
+	unlink(result.Included...)
+
+	return result, nil
+}
+
+func (d *remoteDriver) FindRecord(model, id interface{}, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	c, err := d.connected()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &jsonapi.DocItem{}
+	if _, err := c.do("GET", c.endpoint(model, id, values(query)), nil, result); err != nil {
+		return nil, err
+	}
+
+	if result.Data == nil {
+		return nil, jsonapi.ErrNotFound
+	}
+
+	result.Links = nil
+	unlink(result.Data)
+	unlink(result.Included...)
+
+	return result, nil
+}
+
+func (d *remoteDriver) Delete(model interface{}, id interface{}) error {
+	c, err := d.connected()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do("DELETE", c.endpoint(model, id, nil), nil, nil)
+	return err
+}
+
+func (d *remoteDriver) Update(model interface{}, id interface{}, doc *jsonapi.DocItem) error {
+	c, err := d.connected()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do("PATCH", c.endpoint(model, id, nil), &jsonapi.DocItem{Data: doc.Data, Meta: doc.Meta}, nil)
+	return err
+}
+
+// Create sends resource to remote server. If server responds with
+// "204 No Content", resource is created as it was sent.
+func (d *remoteDriver) Create(model interface{}, doc *jsonapi.DocItem) (*jsonapi.DocItem, error) {
+	c, err := d.connected()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &jsonapi.DocItem{}
+	status, err := c.do("POST", c.endpoint(model, nil, nil), &jsonapi.DocItem{Data: doc.Data, Meta: doc.Meta}, result)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == http.StatusNoContent || result.Data == nil {
+		return &jsonapi.DocItem{Data: doc.Data, JSONApi: &jsonapi.VersionMeta{Version: "1.0"}}, nil
+	}
+
+	result.Links = nil
+	unlink(result.Data)
+	unlink(result.Included...)
+
+	return result, nil
+}
+
+func (d *remoteDriver) ToResource(value interface{}, includes *jsonapi.Includes) *jsonapi.Resource {
+	return local.ToResource(value, includes)
+}
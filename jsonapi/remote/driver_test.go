@@ -0,0 +1,216 @@
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/dmajkic/ibis/jsonapi"
+)
+
+type Article struct {
+	ID    int
+	Title string
+}
+
+type Order struct {
+	ID     int
+	UserID string
+}
+
+func (Order) ParentFilter() string { return "user_id" }
+
+// serve connects driver to test server with handler
+func serve(t *testing.T, handler http.HandlerFunc) (*remoteDriver, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	d := &remoteDriver{}
+	if err := d.ConnectDB(map[string]string{"dbUrl": server.URL + "/v1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	return d, server
+}
+
+// respond returns handler that answers with status and body
+func respond(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", jsonapi.MediaType)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+func TestQueryPassThrough(t *testing.T) {
+	var received *http.Request
+	d, _ := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		respond(http.StatusOK, `{"data":[{"id":"1","type":"articles","attributes":{"title":"a"}}],`+
+			`"links":{"next":"http://remote/v1/articles?page%5Bnumber%5D=2"}}`)(w, r)
+	})
+
+	values, _ := url.ParseQuery("filter[title]=a&sort=-title&page[size]=1&fields[articles]=title")
+	query, err := jsonapi.ParseQuery(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collection, err := d.FindAll(Article{}, nil, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Method != "GET" || received.URL.Path != "/v1/articles" {
+		t.Errorf("got request %s %s", received.Method, received.URL.Path)
+	}
+
+	if got := received.URL.Query(); !reflect.DeepEqual(got, values) {
+		t.Errorf("got query %v, expected %v", got, values)
+	}
+
+	if len(collection.Data) != 1 || collection.Data[0].Attributes["title"] != "a" {
+		t.Errorf("got collection %v", collection.Data)
+	}
+
+	// Links of remote server are relative to request of this one
+	if collection.Links.Next != "?page%5Bnumber%5D=2" {
+		t.Errorf("got next link %q", collection.Links.Next)
+	}
+}
+
+func TestParentScope(t *testing.T) {
+	var received url.Values
+	d, _ := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.Query()
+		respond(http.StatusOK, `{"data":[]}`)(w, r)
+	})
+
+	query, err := jsonapi.ParseQuery(url.Values{"sort": {"-id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.FindAll(Order{}, "7", query); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := url.Values{"sort": {"-id"}, "filter[user_id]": {"7"}}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("got query %v, expected %v", received, expected)
+	}
+
+	// Query of client is not changed
+	if _, ok := query.Values["filter[user_id]"]; ok {
+		t.Errorf("parent filter is added to query %v", query.Values)
+	}
+
+	// Collection that remote server can not limit is not returned at all
+	received = nil
+	if _, err := d.FindAll(Article{}, "7", query); err == nil || received != nil {
+		t.Errorf("got collection of all parents, error %v", err)
+	}
+
+	if _, err := d.FindAll(Article{}, "", query); err != nil {
+		t.Errorf("got error %v without parent", err)
+	}
+}
+
+func TestForwardHeaders(t *testing.T) {
+	var received http.Header
+	d, _ := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		respond(http.StatusOK, `{"data":{"id":"1","type":"articles","attributes":{"title":"a"}}}`)(w, r)
+	})
+
+	request := httptest.NewRequest("GET", "/articles/1", nil)
+	request.Header.Set("Authorization", "Bearer token")
+	request.Header.Set("X-Request-ID", "request-1")
+	request.Header.Set("Cookie", "session=secret")
+
+	db := jsonapi.ForRequest(d, request)
+	if _, err := db.FindRecord(Article{}, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		"Authorization": "Bearer token",
+		"X-Request-ID":  "request-1",
+		"Cookie":        "",
+		"Accept":        jsonapi.MediaType,
+	} {
+		if got := received.Get(name); got != expected {
+			t.Errorf("got %v header %q, expected %q", name, got, expected)
+		}
+	}
+
+	// Driver itself is not bound to request
+	if _, err := d.FindRecord(Article{}, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := received.Get("Authorization"); got != "" {
+		t.Errorf("got Authorization header %q without request", got)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	d, _ := serve(t, respond(http.StatusNotFound, `{"errors":[{"status":"404","detail":"No such article"}]}`))
+
+	if _, err := d.FindRecord(Article{}, 2, nil); err != jsonapi.ErrNotFound {
+		t.Errorf("FindRecord returned %v", err)
+	}
+
+	if err := d.Delete(Article{}, 2); err != jsonapi.ErrNotFound {
+		t.Errorf("Delete returned %v", err)
+	}
+}
+
+func TestErrorDocument(t *testing.T) {
+	doc := &jsonapi.DocItem{Data: &jsonapi.Resource{Type: "articles", Attributes: map[string]interface{}{}}}
+
+	d, _ := serve(t, respond(http.StatusUnprocessableEntity, `{"errors":[`+
+		`{"status":"422","detail":"Title is required","source":{"pointer":"/data/attributes/title"}},`+
+		`{"detail":"Body is too long"}]}`))
+
+	_, err := d.Create(Article{}, doc)
+	errs, ok := err.(jsonapi.Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected two errors, got %v", err)
+	}
+
+	first := errs[0].(*jsonapi.Err)
+	if first.Status != "422" || first.Source.Pointer != "/data/attributes/title" {
+		t.Errorf("got first error %+v", first)
+	}
+
+	// Error without status gets status of response
+	if second := errs[1].(*jsonapi.Err); second.Status != "422" || second.Detail != "Body is too long" {
+		t.Errorf("got second error %+v", second)
+	}
+
+	d, _ = serve(t, respond(http.StatusConflict, `{"errors":[{"status":"409","detail":"Version conflict"}]}`))
+	err = d.Update(Article{}, 1, doc)
+	if e, ok := err.(*jsonapi.Err); !ok || e.Status != "409" || e.Detail != "Version conflict" {
+		t.Errorf("expected single 409 error, got %v", err)
+	}
+
+	// Response that is not error document is reported by its status
+	d, _ = serve(t, respond(http.StatusInternalServerError, `oops`))
+	err = d.Delete(Article{}, 1)
+	if e, ok := err.(*jsonapi.Err); !ok || e.Status != "500" {
+		t.Errorf("expected 500 error, got %v", err)
+	}
+}
+
+func TestTransportFailure(t *testing.T) {
+	d, server := serve(t, respond(http.StatusOK, `{"data":[]}`))
+	server.Close()
+
+	_, err := d.FindAll(Article{}, nil, nil)
+	if e, ok := err.(*jsonapi.Err); !ok || e.Status != "502" {
+		t.Errorf("expected 502 Bad Gateway, got %v", err)
+	}
+}
@@ -3,16 +3,28 @@ package jsonapi
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 )
 
-// DocError creates JSONAPI DocItem document representing errors from error slice
+// DocError creates JSONAPI DocItem document representing errors from error slice.
+// Errors that are already JSONAPI Err objects are used as they are, and Errors
+// lists are expanded.
 func DocError(httpErrorCode int, errors ...error) *DocItem {
-	errorlist := make([]Err, len(errors))
-
-	for i := range errors {
-		errorlist[i].Code = string(httpErrorCode)
-		errorlist[i].Status = http.StatusText(httpErrorCode)
-		errorlist[i].Detail = errors[i].Error()
+	errorlist := make([]Err, 0, len(errors))
+
+	for _, err := range errors {
+		switch e := err.(type) {
+		case *Err:
+			errorlist = append(errorlist, *e)
+		case Errors:
+			errorlist = append(errorlist, DocError(httpErrorCode, e...).Errors...)
+		default:
+			item := Err{}
+			item.Status = strconv.Itoa(httpErrorCode)
+			item.Title = http.StatusText(httpErrorCode)
+			item.Detail = err.Error()
+			errorlist = append(errorlist, item)
+		}
 	}
 
 	return &DocItem{Data: nil, Errors: errorlist}
@@ -30,13 +42,19 @@ func NewResource(id, typeName string) *Resource {
 	}
 }
 
-// SetOneRelationship
+// SetOneRelationship sets to-one relationship linkage. Related resource
+// is added to includes only if relationship path is requested. If model
+// is nil, related resource is not loaded, and linkage is left out.
 func (r *Resource) SetOneRelationship(name string, model interface{}, includes *Includes) *Relationship {
 
 	rel := &Relationship{}
 	r.Relationships[name] = rel
 
 	rel.Links.Related = fmt.Sprintf("%v", name)
+	if r.ID != "" {
+		rel.Links.Self = fmt.Sprintf("/%v/%v/relationships/%v", r.Type, r.ID, name)
+		rel.Links.Related = fmt.Sprintf("/%v/%v/%v", r.Type, r.ID, name)
+	}
 
 	api, ok := model.(ResourceConvertor)
 	if !ok {
@@ -44,54 +62,56 @@ func (r *Resource) SetOneRelationship(name string, model interface{}, includes *
 		return rel
 	}
 
+	includes.Enter(name)
 	resource := api.ToResource(includes)
+	includes.Leave()
+
+	rel.Data = &RelationshipData{IsSingle: true, ResourceIds: []ResourceIdentifier{}}
 
 	if resource.ID == "" {
 		//println(name, ": no ID")
 		return rel
 	}
 
-	rel.Links.Self = fmt.Sprintf("/%v/%v", name, r.ID)
-	rel.Data.IsSingle = true
 	rel.Data.ResourceIds = []ResourceIdentifier{
 		{ID: resource.ID, Type: resource.Type},
 	}
 
-	if includes != nil {
-		includes.Set(resource.ID, resource)
-	}
+	includes.Add(name, resource)
 
 	return rel
 }
 
-// SetManyRelationship
+// SetManyRelationship sets to-many relationship linkage. Related resources
+// are added to includes only if relationship path is requested. If models
+// is nil, related resources are not loaded, and linkage is left out.
 func (r *Resource) SetManyRelationship(name string, models []ResourceConvertor, includes *Includes) *Relationship {
 
 	rel := &Relationship{}
 	r.Relationships[name] = rel
 	rel.Links.Related = fmt.Sprintf("%v", name)
+	if r.ID != "" {
+		rel.Links.Self = fmt.Sprintf("/%v/%v/relationships/%v", r.Type, r.ID, name)
+		rel.Links.Related = fmt.Sprintf("/%v/%v/%v", r.Type, r.ID, name)
+	}
 
-	if len(models) == 0 {
+	if models == nil {
 		//println(name, ": no models")
 		return rel
 	}
 
-	resType := name
-
-	rel.Data.ResourceIds = make([]ResourceIdentifier, len(models))
+	rel.Data = &RelationshipData{ResourceIds: make([]ResourceIdentifier, len(models))}
 	for i, item := range models {
+		includes.Enter(name)
 		resource := item.ToResource(includes)
+		includes.Leave()
+
 		rel.Data.ResourceIds[i] = ResourceIdentifier{
 			ID:   resource.ID,
 			Type: resource.Type,
 		}
-		if includes != nil {
-			includes.Set(resource.ID, resource)
-		}
-		resType = resource.Type
+		includes.Add(name, resource)
 	}
-	rel.Links.Self = fmt.Sprintf("/%v", resType)
-	rel.Data.IsSingle = false
 
 	return rel
 }
@@ -0,0 +1,183 @@
+package jsonapi
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sortable interface is implemented by models that list attributes
+// clients can sort by with sort= query parameter. Other models can
+// be sorted only by id.
+type Sortable interface {
+	SortableFields() []string
+}
+
+// SortField is one sort key from sort=-created_at,name query parameter
+type SortField struct {
+	Name       string
+	Descending bool
+}
+
+// ParseSort extracts sort keys from sort query parameter
+func ParseSort(values url.Values) []SortField {
+	fields := []SortField{}
+
+	for _, value := range values["sort"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+
+			if strings.HasPrefix(name, "-") {
+				fields = append(fields, SortField{Name: name[1:], Descending: true})
+			} else {
+				fields = append(fields, SortField{Name: name})
+			}
+		}
+	}
+
+	return fields
+}
+
+// CheckSort returns "400 Bad Request" error if sort key is not id, or attribute
+// listed by Sortable model. Listed attribute must be in allowed attributes of driver.
+func CheckSort(model interface{}, fields []SortField, allowed map[string]bool) error {
+	var names []string
+	if sortable, ok := model.(Sortable); ok {
+		names = sortable.SortableFields()
+	}
+
+	listed := whitelist(names, allowed)
+
+	for _, field := range fields {
+		if !listed[field.Name] {
+			return ErrParameter("sort", "Sorting by %q is not supported", field.Name)
+		}
+	}
+
+	return nil
+}
+
+// whitelist returns set of id and names that are in allowed attributes
+func whitelist(names []string, allowed map[string]bool) map[string]bool {
+	result := map[string]bool{"id": true}
+	for _, name := range names {
+		if allowed[name] {
+			result[name] = true
+		}
+	}
+
+	return result
+}
+
+// SortResources sorts resources in place by attribute values, or by id
+func SortResources(resources []*Resource, fields []SortField) {
+	if len(fields) == 0 {
+		return
+	}
+
+	sort.SliceStable(resources, func(i, j int) bool {
+		for _, field := range fields {
+			c := CompareValues(sortValue(resources[i], field.Name), sortValue(resources[j], field.Name))
+			if c == 0 {
+				continue
+			}
+			if field.Descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// sortValue returns attribute value of resource, or id. Integer ids are
+// compared as numbers, so that "10" is after "9".
+func sortValue(resource *Resource, name string) interface{} {
+	if name != "id" {
+		return resource.Attributes[name]
+	}
+
+	if id, err := strconv.ParseInt(resource.ID, 10, 64); err == nil {
+		return id
+	}
+
+	return resource.ID
+}
+
+// CompareValues compares two attribute values using reflection.
+// It returns -1, 0 or 1; nil values are ordered first.
+func CompareValues(a, b interface{}) int {
+	va, vb := reflect.Indirect(reflect.ValueOf(a)), reflect.Indirect(reflect.ValueOf(b))
+
+	switch {
+	case !va.IsValid() && !vb.IsValid():
+		return 0
+	case !va.IsValid():
+		return -1
+	case !vb.IsValid():
+		return 1
+	}
+
+	if ta, ok := va.Interface().(time.Time); ok {
+		if tb, ok := vb.Interface().(time.Time); ok {
+			return compare(ta.Before(tb), ta.After(tb))
+		}
+	}
+
+	switch va.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if fa, fb, ok := toFloat(va), toFloat(vb), isNumber(vb); ok {
+			return compare(fa < fb, fa > fb)
+		}
+	case reflect.String:
+		if vb.Kind() == reflect.String {
+			return strings.Compare(va.String(), vb.String())
+		}
+	case reflect.Bool:
+		if vb.Kind() == reflect.Bool {
+			return compare(!va.Bool() && vb.Bool(), va.Bool() && !vb.Bool())
+		}
+	}
+
+	return strings.Compare(fmt.Sprintf("%v", va.Interface()), fmt.Sprintf("%v", vb.Interface()))
+}
+
+func compare(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func isNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return 0
+}
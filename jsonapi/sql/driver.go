@@ -0,0 +1,593 @@
+// Package sql implements JSONAPI database on database/sql, without ORM.
+// Models are mapped to tables with `db` struct tags, and queries use cached
+// prepared statements. Database driver, ie. github.com/mattn/go-sqlite3,
+// is imported by application, and its name is used as adapter.
+package sql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/dmajkic/ibis/jsonapi"
+)
+
+type sqlDriver struct {
+	sync.RWMutex
+
+	db      *sql.DB
+	tx      *sql.Tx
+	dialect dialect
+	stmts   *statements
+	schemas *schemas
+}
+
+func init() {
+	jsonapi.RegisterDriver("sql", &sqlDriver{schemas: &schemas{tables: make(map[reflect.Type]*table)}})
+}
+
+// ConnectDB opens database with adapter and dbUrl, ie. "sqlite3" and file name
+func (d *sqlDriver) ConnectDB(config map[string]string) error {
+	db, err := sql.Open(config["adapter"], config["dbUrl"])
+	if err != nil {
+		return err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+
+	dialect, ok := dialects[config["adapter"]]
+	if !ok {
+		dialect = dialects["sqlite3"]
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.db != nil {
+		d.stmts.close()
+		d.db.Close()
+	}
+
+	d.db = db
+	d.dialect = dialect
+	d.stmts = &statements{db: db, stmts: make(map[string]*sql.Stmt)}
+
+	return nil
+}
+
+// connected returns driver with current connection, or error if database is not connected
+func (d *sqlDriver) connected() (*sqlDriver, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	if d.db == nil {
+		return nil, errors.New("SQL database is not connected")
+	}
+
+	return &sqlDriver{db: d.db, tx: d.tx, dialect: d.dialect, stmts: d.stmts, schemas: d.schemas}, nil
+}
+
+func (d *sqlDriver) FindAll(model interface{}, parentID interface{}, query *jsonapi.Query) (*jsonapi.DocCollection, error) {
+	c, err := d.connected()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.findAll(model, parentID, query)
+	return result, jsonapi.DatabaseError(err)
+}
+
+func (d *sqlDriver) findAll(model interface{}, parentID interface{}, query *jsonapi.Query) (*jsonapi.DocCollection, error) {
+	t, err := d.schemas.table(model)
+	if err != nil {
+		return nil, err
+	}
+
+	// fields[articles]=title,body
+	if err := query.Fields.Check(t.fieldNames()); err != nil {
+		return nil, err
+	}
+
+	// Models have no relationships to include
+	if len(query.Include) > 0 {
+		return nil, jsonapi.ErrParameter("include", "Unknown relationship path %q", query.Include[0])
+	}
+
+	// sort=-created_at,name
+	if err := jsonapi.CheckSort(model, query.Sort, t.attributeNames()); err != nil {
+		return nil, err
+	}
+
+	// filter[title][like]=gorm%, filter[id][in]=1,2
+	if err := jsonapi.CheckFilters(model, query.Filters, t.attributeNames()); err != nil {
+		return nil, err
+	}
+
+	// id is sorted and filtered by primary key column
+	query = query.RenameID(t.pk.name)
+
+	q := &selectQuery{}
+	defaultScope(q, model, parentID)
+
+	if err := whereFilters(q, d.dialect, t, query.Filters); err != nil {
+		return nil, err
+	}
+
+	result := &jsonapi.DocCollection{
+		JSONApi: &jsonapi.VersionMeta{Version: "1.0"},
+	}
+
+	// page[number] and page[size], or page[after] and page[before]
+	mode := jsonapi.GetResourceOptions(model).Pagination
+	if err := query.Page.Check(mode); err != nil {
+		return nil, err
+	}
+
+	var items []reflect.Value
+	if mode == jsonapi.CursorPagination {
+		items, err = d.findCursor(t, q, query, result)
+	} else {
+		items, err = d.findPage(t, q, model, query, result)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	collection := make([]*jsonapi.Resource, len(items))
+	includes := jsonapi.NewIncludes(query.Include...)
+
+	for i := range collection {
+		collection[i] = d.ToResource(items[i].Interface(), includes)
+	}
+
+	query.Fields.Apply(collection...)
+	result.Data = collection
+
+	return result, nil
+}
+
+// load returns models selected by query, as pointers to structs
+func (d *sqlDriver) load(t *table, query string, args []interface{}) ([]reflect.Value, error) {
+	items := []reflect.Value{}
+
+	err := d.scan(query, args, func(rows *sql.Rows) error {
+		item := reflect.New(t.typ)
+		if err := rows.Scan(t.scanTargets(item.Elem())...); err != nil {
+			return err
+		}
+
+		items = append(items, item)
+		return nil
+	})
+
+	return items, err
+}
+
+// findPage loads models using page[number] and page[size] offset pagination
+func (d *sqlDriver) findPage(t *table, q *selectQuery, model interface{}, query *jsonapi.Query, result *jsonapi.DocCollection) ([]reflect.Value, error) {
+	page := query.Page
+
+	var total int
+	count, args := q.sql(d.dialect, t, "COUNT(*)", -1, -1)
+	if err := d.scan(count, args, func(rows *sql.Rows) error { return rows.Scan(&total) }); err != nil {
+		return nil, err
+	}
+
+	orderBy(q, d.dialect, model, query.Sort)
+
+	text, args := q.sql(d.dialect, t, t.columnNames(d.dialect), page.Size, page.Offset())
+	items, err := d.load(t, text, args)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Paginate(query, total)
+	return items, nil
+}
+
+// findCursor loads models using page[after] and page[before] keyset pagination.
+// Models are ordered by sort keys and primary key, which are encoded in cursors.
+// DefaultOrder is not used, since it would make pages unstable.
+func (d *sqlDriver) findCursor(t *table, q *selectQuery, query *jsonapi.Query, result *jsonapi.DocCollection) ([]reflect.Value, error) {
+	// Keyset condition compares keys with = and <, which never match NULL values
+	for _, key := range query.Sort {
+		if c, ok := t.byName[key.Name]; ok && c.nullable() {
+			return nil, jsonapi.ErrParameter("sort", "Sorting by %q can not be used with cursor pagination, since it can be null", key.Name)
+		}
+	}
+
+	cursor := query.Page
+	keys := cursorKeys(t, query.Sort)
+	backward := cursor.Before != ""
+
+	token, param := cursor.After, "page[after]"
+	if backward {
+		token, param = cursor.Before, "page[before]"
+	}
+
+	if token != "" {
+		if err := whereCursor(q, d.dialect, t, keys, param, token, backward); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, key := range keys {
+		column := d.dialect.Quote(key.Name)
+		if key.Descending != backward {
+			column += " desc"
+		}
+		q.Order(column)
+	}
+
+	text, args := q.sql(d.dialect, t, t.columnNames(d.dialect), cursor.Size+1, -1)
+	items, err := d.load(t, text, args)
+	if err != nil {
+		return nil, err
+	}
+
+	more := len(items) > cursor.Size
+	if more {
+		items = items[:cursor.Size]
+	}
+
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	var prev, next string
+	if len(items) > 0 {
+		if (backward && more) || cursor.After != "" {
+			if prev, err = cursorOf(t, items[0].Elem(), keys); err != nil {
+				return nil, err
+			}
+		}
+
+		if (!backward && more) || backward {
+			if next, err = cursorOf(t, items[len(items)-1].Elem(), keys); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result.PaginateCursor(query, prev, next)
+	return items, nil
+}
+
+func (d *sqlDriver) FindRecord(model, id interface{}, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	c, err := d.connected()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.findRecord(model, id, query)
+	return result, jsonapi.DatabaseError(err)
+}
+
+func (d *sqlDriver) findRecord(model, id interface{}, query *jsonapi.Query) (*jsonapi.DocItem, error) {
+	t, err := d.schemas.table(model)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := query.Fields.Check(t.fieldNames()); err != nil {
+		return nil, err
+	}
+
+	if len(query.Include) > 0 {
+		return nil, jsonapi.ErrParameter("include", "Unknown relationship path %q", query.Include[0])
+	}
+
+	item, err := d.find(t, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resource := d.ToResource(item.Interface(), jsonapi.NewIncludes())
+	query.Fields.Apply(resource)
+
+	return &jsonapi.DocItem{
+		Data:    resource,
+		JSONApi: &jsonapi.VersionMeta{Version: "1.0"},
+	}, nil
+}
+
+// find loads model by primary key, as pointer to struct
+func (d *sqlDriver) find(t *table, id interface{}) (reflect.Value, error) {
+	key, err := t.key(id)
+	if err != nil {
+		return reflect.Value{}, jsonapi.ErrNotFound
+	}
+
+	q := &selectQuery{}
+	q.Where(d.dialect.Quote(t.pk.name)+" = ?", key.Interface())
+
+	text, args := q.sql(d.dialect, t, t.columnNames(d.dialect), -1, -1)
+	items, err := d.load(t, text, args)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if len(items) == 0 {
+		return reflect.Value{}, jsonapi.ErrNotFound
+	}
+
+	return items[0], nil
+}
+
+func (d *sqlDriver) Delete(model interface{}, id interface{}) error {
+	c, err := d.connected()
+	if err != nil {
+		return err
+	}
+
+	return jsonapi.DeleteError(c.delete(model, id))
+}
+
+func (d *sqlDriver) delete(model interface{}, id interface{}) error {
+	t, err := d.schemas.table(model)
+	if err != nil {
+		return err
+	}
+
+	key, err := t.key(id)
+	if err != nil {
+		return jsonapi.ErrNotFound
+	}
+
+	result, err := d.exec("DELETE FROM "+d.dialect.Quote(t.name)+" WHERE "+d.dialect.Quote(t.pk.name)+" = ?", key.Interface())
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return jsonapi.ErrNotFound
+	}
+
+	return nil
+}
+
+func (d *sqlDriver) Update(model interface{}, id interface{}, doc *jsonapi.DocItem) error {
+	c, err := d.connected()
+	if err != nil {
+		return err
+	}
+
+	return jsonapi.DatabaseError(c.transaction(func(tx *sqlDriver) error {
+		return tx.update(model, id, doc)
+	}))
+}
+
+func (d *sqlDriver) update(model interface{}, id interface{}, doc *jsonapi.DocItem) error {
+	t, err := d.schemas.table(model)
+	if err != nil {
+		return err
+	}
+
+	item, err := d.find(t, id)
+	if err != nil {
+		return err
+	}
+
+	names, err := t.decodeAttributes(item.Elem(), doc.Data.Attributes)
+	if err != nil {
+		return err
+	}
+
+	if err := checkRelationships(doc.Data.Relationships); err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	sets := ""
+	args := make([]interface{}, 0, len(names)+1)
+
+	for i, name := range names {
+		if i > 0 {
+			sets += ", "
+		}
+		sets += d.dialect.Quote(name) + " = ?"
+		args = append(args, item.Elem().FieldByIndex(t.byName[name].index).Interface())
+	}
+
+	args = append(args, item.Elem().FieldByIndex(t.pk.index).Interface())
+
+	_, err = d.exec("UPDATE "+d.dialect.Quote(t.name)+" SET "+sets+" WHERE "+d.dialect.Quote(t.pk.name)+" = ?", args...)
+	return err
+}
+
+func (d *sqlDriver) Create(model interface{}, doc *jsonapi.DocItem) (*jsonapi.DocItem, error) {
+	c, err := d.connected()
+	if err != nil {
+		return nil, err
+	}
+
+	var id string
+
+	err = c.transaction(func(tx *sqlDriver) error {
+		id, err = tx.create(model, doc)
+		return err
+	})
+
+	if err != nil {
+		return nil, jsonapi.DatabaseError(err)
+	}
+
+	result, err := c.findRecord(model, id, jsonapi.NewQuery())
+	return result, jsonapi.DatabaseError(err)
+}
+
+// create inserts new record, and returns its id
+func (d *sqlDriver) create(model interface{}, doc *jsonapi.DocItem) (string, error) {
+	t, err := d.schemas.table(model)
+	if err != nil {
+		return "", err
+	}
+
+	item := reflect.New(t.typ)
+	if _, err := t.decodeAttributes(item.Elem(), doc.Data.Attributes); err != nil {
+		return "", err
+	}
+
+	if err := checkRelationships(doc.Data.Relationships); err != nil {
+		return "", err
+	}
+
+	// Client-generated id is used as it is, else id is generated,
+	// or left to database for autoincrement keys
+	id := doc.Data.ID
+	if id == "" {
+		fallback := jsonapi.UUIDv4
+		if t.isInteger() {
+			fallback = jsonapi.AutoIncrement
+		}
+
+		if id, err = jsonapi.NewID(model, fallback); err != nil {
+			return "", err
+		}
+	}
+
+	columns := t.columns
+	if id != "" {
+		key, err := t.key(id)
+		if err != nil {
+			return "", err
+		}
+
+		if doc.Data.ID != "" {
+			if _, err := d.find(t, id); err == nil {
+				e := jsonapi.NewErr(http.StatusConflict, "Resource with id %q already exists", id)
+				e.Source.Pointer = "/data/id"
+				return "", e
+			} else if err != jsonapi.ErrNotFound {
+				return "", err
+			}
+		}
+
+		item.Elem().FieldByIndex(t.pk.index).Set(key)
+		columns = append([]*column{t.pk}, columns...)
+	}
+
+	names, marks := "", ""
+	args := make([]interface{}, len(columns))
+
+	for i, c := range columns {
+		if i > 0 {
+			names, marks = names+", ", marks+", "
+		}
+		names += d.dialect.Quote(c.name)
+		marks += "?"
+		args[i] = item.Elem().FieldByIndex(c.index).Interface()
+	}
+
+	insert := "INSERT INTO " + d.dialect.Quote(t.name) + " (" + names + ") VALUES (" + marks + ")"
+
+	if id != "" {
+		_, err = d.exec(insert, args...)
+		return id, err
+	}
+
+	if d.dialect.returning {
+		err = d.scan(insert+" RETURNING "+d.dialect.Quote(t.pk.name), args, func(rows *sql.Rows) error {
+			return rows.Scan(&id)
+		})
+		return id, err
+	}
+
+	result, err := d.exec(insert, args...)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := result.LastInsertId()
+	return fmt.Sprintf("%d", n), err
+}
+
+// Transaction runs fn with driver working within database transaction
+func (d *sqlDriver) Transaction(fn func(db jsonapi.Database) error) error {
+	c, err := d.connected()
+	if err != nil {
+		return err
+	}
+
+	return jsonapi.DatabaseError(c.transaction(func(tx *sqlDriver) error {
+		return fn(tx)
+	}))
+}
+
+// transaction runs fn in database transaction, that is rolled back if fn returns error.
+// If driver already works within transaction, fn is a part of it.
+func (d *sqlDriver) transaction(fn func(tx *sqlDriver) error) error {
+	if d.tx != nil {
+		return fn(d)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&sqlDriver{db: d.db, tx: tx, dialect: d.dialect, stmts: d.stmts, schemas: d.schemas}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AttributeName returns resource attribute name of model field, that is its column name
+func (d *sqlDriver) AttributeName(model interface{}, field string) string {
+	t, err := d.schemas.table(model)
+	if err != nil {
+		return snakeCase(field)
+	}
+
+	for _, c := range t.columns {
+		if t.typ.FieldByIndex(c.index).Name == field {
+			return c.name
+		}
+	}
+
+	return snakeCase(field)
+}
+
+func (d *sqlDriver) ToResource(value interface{}, includes *jsonapi.Includes) *jsonapi.Resource {
+
+	// Use ApiConvertor interface if there is one
+	if convertor, implements := value.(jsonapi.ResourceConvertor); implements {
+		return convertor.ToResource(includes)
+	}
+
+	t, err := d.schemas.table(value)
+	if err != nil {
+		return jsonapi.NewResource(fmt.Sprintf("%v", value), reflect.TypeOf(value).Name())
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(value))
+	pk := v.FieldByIndex(t.pk.index)
+
+	id := ""
+	if r, ok := value.(jsonapi.Resourcer); ok {
+		id = r.GetID()
+	} else if !reflect.DeepEqual(pk.Interface(), reflect.Zero(pk.Type()).Interface()) {
+		id = fmt.Sprintf("%v", reflect.Indirect(pk).Interface())
+	}
+
+	resource := jsonapi.NewResource(id, t.name)
+	for _, c := range t.columns {
+		resource.Attributes[c.name] = v.FieldByIndex(c.index).Interface()
+	}
+
+	return resource
+}
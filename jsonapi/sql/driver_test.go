@@ -0,0 +1,319 @@
+package sql
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/dmajkic/ibis/jsonapi"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Article struct {
+	ID     int
+	Title  string `db:"title"`
+	Body   *string
+	Rating float64
+	UserID int
+}
+
+func (Article) SortableFields() []string   { return []string{"title", "rating"} }
+func (Article) FilterableFields() []string { return []string{"title", "rating", "body", "user_id"} }
+
+type Comment struct {
+	ID        int
+	ArticleID int
+}
+
+type Label struct {
+	Code string `db:"code,pk"`
+	Name string
+}
+
+func (Label) SortableFields() []string   { return []string{"name"} }
+func (Label) FilterableFields() []string { return []string{"name"} }
+
+// connect opens driver on new sqlite file with enforced foreign keys, with tables of test models
+func connect(t *testing.T) *sqlDriver {
+	d := &sqlDriver{schemas: &schemas{tables: make(map[reflect.Type]*table)}}
+
+	config := map[string]string{"adapter": "sqlite3", "dbUrl": filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=1"}
+	if err := d.ConnectDB(config); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		d.stmts.close()
+		d.db.Close()
+	})
+
+	for _, ddl := range []string{
+		`CREATE TABLE articles (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, body TEXT, rating REAL, user_id INTEGER)`,
+		`CREATE TABLE labels (code TEXT PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE comments (id INTEGER PRIMARY KEY AUTOINCREMENT, article_id INTEGER REFERENCES articles(id))`,
+	} {
+		if _, err := d.db.Exec(ddl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return d
+}
+
+// seed creates articles "a" to "e", with ratings 1 to 5
+func seed(t *testing.T, d *sqlDriver) {
+	for i, title := range []string{"a", "b", "c", "d", "e"} {
+		body := `{"data":{"type":"articles","attributes":{"title":"` + title + `","rating":` + strconv.Itoa(i+1) + `,"user_id":1}}}`
+		if _, err := d.Create(Article{}, document(t, body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func document(t *testing.T, body string) *jsonapi.DocItem {
+	doc := &jsonapi.DocItem{Data: jsonapi.NewResource("", "")}
+	if err := json.Unmarshal([]byte(body), doc); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func query(t *testing.T, raw string) *jsonapi.Query {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, err := jsonapi.ParseQuery(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return query
+}
+
+// titles returns title attributes of collection, in order
+func titles(collection *jsonapi.DocCollection) []string {
+	result := []string{}
+	for _, resource := range collection.Data {
+		result = append(result, resource.Attributes["title"].(string))
+	}
+
+	return result
+}
+
+func status(err error) string {
+	if e, ok := err.(*jsonapi.Err); ok {
+		return e.Status
+	}
+
+	return ""
+}
+
+func TestCRUD(t *testing.T) {
+	d := connect(t)
+
+	created, err := d.Create(Article{}, document(t, `{"data":{"type":"articles","attributes":{"title":"a","rating":4.5}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := created.Data.ID
+	if id != "1" || created.Data.Type != "articles" {
+		t.Fatalf("created %s/%s, expected articles/1", created.Data.Type, id)
+	}
+
+	if err := d.Update(Article{}, id, document(t, `{"data":{"type":"articles","id":"1","attributes":{"body":"text"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := d.FindRecord(Article{}, id, jsonapi.NewQuery())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes := found.Data.Attributes
+	if attributes["title"] != "a" || attributes["rating"] != 4.5 || *attributes["body"].(*string) != "text" {
+		t.Errorf("found attributes %v", attributes)
+	}
+
+	if err := d.Delete(Article{}, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.FindRecord(Article{}, id, jsonapi.NewQuery()); err != jsonapi.ErrNotFound {
+		t.Errorf("found deleted article, error %v", err)
+	}
+
+	if err := d.Delete(Article{}, id); err != jsonapi.ErrNotFound {
+		t.Errorf("deleted article twice, error %v", err)
+	}
+
+	if err := d.Update(Article{}, id, document(t, `{"data":{"type":"articles","id":"1","attributes":{"title":"b"}}}`)); err != jsonapi.ErrNotFound {
+		t.Errorf("updated deleted article, error %v", err)
+	}
+}
+
+func TestCreateDuplicateID(t *testing.T) {
+	d := connect(t)
+
+	body := `{"data":{"type":"labels","id":"new","attributes":{"name":"New"}}}`
+	if _, err := d.Create(Label{}, document(t, body)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := d.Create(Label{}, document(t, body))
+	if status(err) != "409" {
+		t.Fatalf("expected 409 Conflict, got %v", err)
+	}
+
+	if e := err.(*jsonapi.Err); e.Source.Pointer != "/data/id" {
+		t.Errorf("expected pointer to /data/id, got %q", e.Source.Pointer)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	d := connect(t)
+	seed(t, d)
+
+	_, err := d.Create(Comment{}, document(t, `{"data":{"type":"comments","attributes":{"article_id":9}}}`))
+	if status(err) != "422" {
+		t.Errorf("expected 422 Unprocessable Entity for missing article, got %v", err)
+	}
+
+	if _, err := d.Create(Comment{}, document(t, `{"data":{"type":"comments","attributes":{"article_id":1}}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete(Article{}, "1"); status(err) != "409" {
+		t.Errorf("expected 409 Conflict for referenced article, got %v", err)
+	}
+
+	if err := d.Delete(Comment{}, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete(Article{}, "1"); err != nil {
+		t.Errorf("got error %v without references", err)
+	}
+}
+
+func TestFilterAndSort(t *testing.T) {
+	d := connect(t)
+	seed(t, d)
+
+	if err := d.Update(Article{}, "2", document(t, `{"data":{"type":"articles","id":"2","attributes":{"body":"text"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		query    string
+		expected []string
+	}{
+		{"sort=-rating", []string{"e", "d", "c", "b", "a"}},
+		{"sort=title", []string{"a", "b", "c", "d", "e"}},
+		{"sort=-id", []string{"e", "d", "c", "b", "a"}},
+		{"filter[rating][ge]=4&sort=title", []string{"d", "e"}},
+		{"filter[title][in]=a,c,x&sort=-title", []string{"c", "a"}},
+		{"filter[title][like]=%25b%25", []string{"b"}},
+		{"filter[body][null]=false", []string{"b"}},
+		{"filter[id][in]=1,3&sort=id", []string{"a", "c"}},
+		{"filter[user_id]=2", []string{}},
+	} {
+		collection, err := d.FindAll(Article{}, nil, query(t, test.query))
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+
+		if got := titles(collection); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.query, got, test.expected)
+		}
+	}
+
+	for _, raw := range []string{"sort=name", "sort=body", "filter[name]=a", "filter[rating]=high"} {
+		if _, err := d.FindAll(Article{}, nil, query(t, raw)); status(err) != "400" {
+			t.Errorf("%s: expected 400 Bad Request, got %v", raw, err)
+		}
+	}
+}
+
+func TestOffsetPagination(t *testing.T) {
+	d := connect(t)
+	seed(t, d)
+
+	collection, err := d.FindAll(Article{}, nil, query(t, "sort=title&page[number]=2&page[size]=2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := titles(collection); !reflect.DeepEqual(got, []string{"c", "d"}) {
+		t.Errorf("got page %v", got)
+	}
+
+	if collection.Meta["total"] != 5 || collection.Meta["pages"] != 3 {
+		t.Errorf("got meta %v", collection.Meta)
+	}
+
+	if collection.Links.Prev == "" || collection.Links.Next == "" {
+		t.Errorf("expected prev and next links, got %+v", collection.Links)
+	}
+
+	if _, err := d.FindAll(Article{}, nil, query(t, "page[after]=x")); status(err) != "400" {
+		t.Errorf("expected 400 Bad Request for page[after], got %v", err)
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	d := connect(t)
+	seed(t, d)
+
+	jsonapi.SetResourceOptions(Article{}, jsonapi.ResourceOptions{Pagination: jsonapi.CursorPagination})
+	defer jsonapi.SetResourceOptions(Article{}, jsonapi.ResourceOptions{})
+
+	pages := [][]string{}
+	link := "?sort=-rating&page[size]=2"
+
+	for link != "" && len(pages) < 5 {
+		collection, err := d.FindAll(Article{}, nil, query(t, link[1:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pages = append(pages, titles(collection))
+		link = collection.Links.Next
+	}
+
+	expected := [][]string{{"e", "d"}, {"c", "b"}, {"a"}}
+	if !reflect.DeepEqual(pages, expected) {
+		t.Fatalf("got pages %v, expected %v", pages, expected)
+	}
+
+	// Page before second one is the first one
+	second, err := d.FindAll(Article{}, nil, query(t, "sort=-rating&page[size]=2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err = d.FindAll(Article{}, nil, query(t, second.Links.Next[1:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := d.FindAll(Article{}, nil, query(t, second.Links.Prev[1:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := titles(first); !reflect.DeepEqual(got, []string{"e", "d"}) {
+		t.Errorf("got previous page %v", got)
+	}
+
+	if _, err := d.FindAll(Article{}, nil, query(t, "page[after]=broken")); status(err) != "400" {
+		t.Errorf("expected 400 Bad Request for broken cursor, got %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package sql
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/dmajkic/ibis/jsonapi"
+)
+
+// Scoper sets default scope on model collection, ie. records of parent.
+// Condition is SQL expression with ? placeholders for args.
+type Scoper interface {
+	DefaultScope(parentID interface{}) (condition string, args []interface{})
+}
+
+// Orderer sets default order of model collection, ie. "created_at desc".
+// Sort keys requested by client are applied before it, so it only breaks ties.
+type Orderer interface {
+	DefaultOrder() string
+}
+
+// selectQuery collects parts of SELECT statement
+type selectQuery struct {
+	where []string
+	args  []interface{}
+	order []string
+}
+
+// Where adds condition with ? placeholders for args
+func (q *selectQuery) Where(condition string, args ...interface{}) {
+	q.where = append(q.where, "("+condition+")")
+	q.args = append(q.args, args...)
+}
+
+// Order adds order expression
+func (q *selectQuery) Order(order string) {
+	q.order = append(q.order, order)
+}
+
+// sql returns SELECT statement of columns, with limit and offset if they are not negative
+func (q *selectQuery) sql(d dialect, t *table, columns string, limit, offset int) (string, []interface{}) {
+	query := "SELECT " + columns + " FROM " + d.Quote(t.name)
+	args := append([]interface{}{}, q.args...)
+
+	if len(q.where) > 0 {
+		query += " WHERE " + strings.Join(q.where, " AND ")
+	}
+
+	if len(q.order) > 0 {
+		query += " ORDER BY " + strings.Join(q.order, ", ")
+	}
+
+	if limit >= 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	if offset >= 0 {
+		query += " OFFSET ?"
+		args = append(args, offset)
+	}
+
+	return query, args
+}
+
+// defaultScope limits query with Scoper of model
+func defaultScope(q *selectQuery, model interface{}, parentID interface{}) {
+	if scoper, ok := model.(Scoper); ok {
+		if condition, args := scoper.DefaultScope(parentID); condition != "" {
+			q.Where(condition, args...)
+		}
+	}
+}
+
+// orderBy orders query by sort keys and Orderer of model
+func orderBy(q *selectQuery, d dialect, model interface{}, sort []jsonapi.SortField) {
+	for _, field := range sort {
+		column := d.Quote(field.Name)
+		if field.Descending {
+			column += " desc"
+		}
+		q.Order(column)
+	}
+
+	if orderer, ok := model.(Orderer); ok {
+		if order := orderer.DefaultOrder(); order != "" {
+			q.Order(order)
+		}
+	}
+}
+
+var filterSQL = map[string]string{
+	jsonapi.FilterEq:   " = ?",
+	jsonapi.FilterNe:   " <> ?",
+	jsonapi.FilterLt:   " < ?",
+	jsonapi.FilterLe:   " <= ?",
+	jsonapi.FilterGt:   " > ?",
+	jsonapi.FilterGe:   " >= ?",
+	jsonapi.FilterLike: " LIKE ?",
+}
+
+// whereFilters limits query with filter conditions. Values are converted
+// to column types, with "400 Bad Request" error pointing to filter
+// parameter if conversion fails.
+func whereFilters(q *selectQuery, d dialect, t *table, filters []jsonapi.Filter) error {
+	for _, filter := range filters {
+		c, ok := t.byName[filter.Name]
+		if !ok {
+			return jsonapi.ErrParameter(filter.Parameter, "Unknown filter attribute %q", filter.Name)
+		}
+
+		name := d.Quote(c.name)
+
+		switch filter.Op {
+		case jsonapi.FilterNull:
+			if filter.Values[0] == "true" {
+				q.Where(name + " IS NULL")
+			} else {
+				q.Where(name + " IS NOT NULL")
+			}
+
+		case jsonapi.FilterLike:
+			q.Where(name+filterSQL[filter.Op], filter.Values[0])
+
+		default:
+			values := make([]interface{}, len(filter.Values))
+			for i, value := range filter.Values {
+				v, err := jsonapi.ParseValue(c.typ, value)
+				if err != nil {
+					return jsonapi.ErrParameter(filter.Parameter, "%v", err)
+				}
+				values[i] = v
+			}
+
+			if filter.Op == jsonapi.FilterIn {
+				q.Where(name+" IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")+")", values...)
+			} else {
+				q.Where(name+filterSQL[filter.Op], values...)
+			}
+		}
+	}
+
+	return nil
+}
+
+// cursorKeys returns sort keys of cursor pagination, ending with primary key
+func cursorKeys(t *table, sort []jsonapi.SortField) []jsonapi.SortField {
+	return append(append([]jsonapi.SortField{}, sort...), jsonapi.SortField{Name: t.pk.name})
+}
+
+// cursorOf encodes key values of model to cursor
+func cursorOf(t *table, item reflect.Value, keys []jsonapi.SortField) (string, error) {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = item.FieldByIndex(t.byName[key.Name].index).Interface()
+	}
+
+	return jsonapi.EncodeCursor(values...)
+}
+
+// whereCursor limits query to rows after (or before) cursor:
+// (k1 > ?) OR (k1 = ? AND k2 > ?) OR ...
+func whereCursor(q *selectQuery, d dialect, t *table, keys []jsonapi.SortField, param, token string, backward bool) error {
+	raw, err := jsonapi.DecodeCursor(param, token, len(keys))
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		value := reflect.New(t.byName[key.Name].typ)
+		if err := json.Unmarshal(raw[i], value.Interface()); err != nil {
+			return jsonapi.ErrParameter(param, "Invalid cursor")
+		}
+		values[i] = value.Elem().Interface()
+	}
+
+	terms := make([]string, len(keys))
+	args := []interface{}{}
+
+	for i, key := range keys {
+		parts := make([]string, 0, i+1)
+		for _, equal := range keys[:i] {
+			parts = append(parts, d.Quote(equal.Name)+" = ?")
+		}
+
+		op := " > ?"
+		if key.Descending != backward {
+			op = " < ?"
+		}
+
+		terms[i] = "(" + strings.Join(append(parts, d.Quote(key.Name)+op), " AND ") + ")"
+		args = append(args, values[:i+1]...)
+	}
+
+	q.Where(strings.Join(terms, " OR "), args...)
+	return nil
+}
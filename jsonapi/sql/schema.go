@@ -0,0 +1,330 @@
+package sql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/dmajkic/ibis/jsonapi"
+)
+
+// Tabler is implemented by models stored in table other than
+// snake_case plural of model name, ie. "blog_posts" for BlogPost
+type Tabler interface {
+	TableName() string
+}
+
+// column maps struct field to table column. Column name is also attribute name.
+type column struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+// nullable reports if column can hold NULL, that is pointer or sql.Scanner like sql.NullString
+func (c *column) nullable() bool {
+	return c.typ.Kind() == reflect.Ptr || reflect.PtrTo(c.typ).Implements(scannerType)
+}
+
+// table is schema of model struct, read from `db` struct tags:
+//
+//	ID    int    `db:"id,pk"`
+//	Title string `db:"title"`
+//	Cache string `db:"-"`
+//
+// Fields without tag use snake_case names, and ID field is primary key.
+type table struct {
+	name    string
+	typ     reflect.Type
+	pk      *column
+	columns []*column
+	byName  map[string]*column
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// schemas caches tables by model type, so struct tags are read once
+type schemas struct {
+	sync.RWMutex
+	tables map[reflect.Type]*table
+}
+
+// table returns schema of model, that is struct or pointer to struct
+func (s *schemas) table(model interface{}) (*table, error) {
+	typ := reflect.TypeOf(model)
+	for typ != nil && (typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice) {
+		typ = typ.Elem()
+	}
+
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, jsonapi.NewErr(http.StatusInternalServerError, "Model %T is not a struct", model)
+	}
+
+	s.RLock()
+	t, ok := s.tables[typ]
+	s.RUnlock()
+
+	if ok {
+		return t, nil
+	}
+
+	t = &table{
+		name:   tableName(typ),
+		typ:    typ,
+		byName: make(map[string]*column),
+	}
+	t.addColumns(typ, nil)
+
+	if t.pk == nil {
+		return nil, jsonapi.NewErr(http.StatusInternalServerError, "Model %v has no primary key", typ.Name())
+	}
+
+	s.Lock()
+	s.tables[typ] = t
+	s.Unlock()
+
+	return t, nil
+}
+
+// addColumns adds columns for fields of struct type, and fields of embedded structs
+func (t *table) addColumns(typ reflect.Type, index []int) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		tag := field.Tag.Get("db")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			t.addColumns(field.Type, fieldIndex)
+			continue
+		}
+
+		if tag == "" && !isColumnType(field.Type) {
+			continue
+		}
+
+		options := strings.Split(tag, ",")
+		c := &column{name: options[0], index: fieldIndex, typ: field.Type}
+		if c.name == "" {
+			c.name = snakeCase(field.Name)
+		}
+
+		pk := false
+		for _, option := range options[1:] {
+			pk = pk || option == "pk"
+		}
+
+		if pk || (t.pk == nil && field.Name == "ID") {
+			if t.pk != nil {
+				t.columns = append(t.columns, t.pk)
+			}
+			t.pk = c
+		} else {
+			t.columns = append(t.columns, c)
+		}
+
+		t.byName[c.name] = c
+	}
+}
+
+// isColumnType reports if field type is stored in single column
+func isColumnType(typ reflect.Type) bool {
+	if typ.Implements(scannerType) || reflect.PtrTo(typ).Implements(scannerType) || typ.Implements(valuerType) {
+		return true
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		return typ == timeType
+	case reflect.Slice:
+		return typ.Elem().Kind() == reflect.Uint8
+	case reflect.Map, reflect.Array, reflect.Chan, reflect.Func, reflect.Interface, reflect.UnsafePointer:
+		return false
+	}
+
+	return true
+}
+
+// tableName returns table name of model type, from Tabler or snake_case plural of type name
+func tableName(typ reflect.Type) string {
+	if tabler, ok := reflect.New(typ).Interface().(Tabler); ok {
+		return tabler.TableName()
+	}
+
+	name := snakeCase(typ.Name())
+
+	switch {
+	case strings.HasSuffix(name, "y") && !strings.HasSuffix(name, "ay") && !strings.HasSuffix(name, "ey") &&
+		!strings.HasSuffix(name, "oy") && !strings.HasSuffix(name, "uy"):
+		return name[:len(name)-1] + "ies"
+	case strings.HasSuffix(name, "s") || strings.HasSuffix(name, "x") || strings.HasSuffix(name, "z") ||
+		strings.HasSuffix(name, "ch") || strings.HasSuffix(name, "sh"):
+		return name + "es"
+	}
+
+	return name + "s"
+}
+
+// snakeCase converts Go name to snake_case, keeping initialisms together, ie. "UserID" to "user_id"
+func snakeCase(name string) string {
+	runes := []rune(name)
+	result := make([]rune, 0, len(runes)+4)
+
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				result = append(result, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		result = append(result, r)
+	}
+
+	return string(result)
+}
+
+// attributeNames returns set of attribute names, same as in ToResource
+func (t *table) attributeNames() map[string]bool {
+	names := make(map[string]bool, len(t.columns))
+	for _, c := range t.columns {
+		names[c.name] = true
+	}
+
+	return names
+}
+
+// fieldNames returns attribute names by resource type, for Fieldsets.Check.
+// Models with own ResourceConvertor are not checked.
+func (t *table) fieldNames() map[string]map[string]bool {
+	known := make(map[string]map[string]bool)
+
+	if !reflect.PtrTo(t.typ).Implements(convertorType) {
+		known[t.name] = t.attributeNames()
+	}
+
+	return known
+}
+
+var convertorType = reflect.TypeOf((*jsonapi.ResourceConvertor)(nil)).Elem()
+
+// columnNames returns quoted names of primary key and all columns
+func (t *table) columnNames(d dialect) string {
+	names := make([]string, 0, len(t.columns)+1)
+	names = append(names, d.Quote(t.pk.name))
+
+	for _, c := range t.columns {
+		names = append(names, d.Quote(c.name))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// scanTargets returns pointers to fields of struct value, in columnNames order
+func (t *table) scanTargets(value reflect.Value) []interface{} {
+	targets := make([]interface{}, 0, len(t.columns)+1)
+	targets = append(targets, value.FieldByIndex(t.pk.index).Addr().Interface())
+
+	for _, c := range t.columns {
+		targets = append(targets, value.FieldByIndex(c.index).Addr().Interface())
+	}
+
+	return targets
+}
+
+// decodeAttributes sets resource attributes to fields of struct value, converted
+// to field types. Names of set columns are returned, sorted. Unknown attributes
+// and values of wrong type are reported as "422 Unprocessable Entity".
+func (t *table) decodeAttributes(value reflect.Value, attributes map[string]interface{}) ([]string, error) {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := jsonapi.Errors{}
+
+	for _, name := range names {
+		c, ok := t.byName[name]
+		if !ok || c == t.pk {
+			errs = append(errs, jsonapi.ErrAttribute(name, "Unknown attribute %q", name))
+			continue
+		}
+
+		v, err := jsonapi.DecodeValue(c.typ, attributes[name])
+		if err != nil {
+			errs = append(errs, jsonapi.ErrAttribute(name, "Invalid %v: %v", name, err))
+			continue
+		}
+
+		value.FieldByIndex(c.index).Set(v)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return names, nil
+}
+
+// checkRelationships rejects relationships in resource document,
+// since models are mapped to single tables
+func checkRelationships(relationships map[string]*jsonapi.Relationship) error {
+	names := make([]string, 0, len(relationships))
+	for name := range relationships {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		e := jsonapi.NewErr(http.StatusUnprocessableEntity, "Unknown relationship %q", name)
+		e.Source.Pointer = "/data/relationships/" + name
+		return e
+	}
+
+	return nil
+}
+
+// key converts id to primary key type, with "422 Unprocessable Entity" if it is not valid
+func (t *table) key(id interface{}) (reflect.Value, error) {
+	value, err := jsonapi.ParseValue(t.pk.typ, fmt.Sprintf("%v", id))
+	if err == nil && !reflect.TypeOf(value).ConvertibleTo(t.pk.typ) {
+		err = fmt.Errorf("Unsupported id type %v", t.pk.typ)
+	}
+
+	if err != nil {
+		e := jsonapi.NewErr(http.StatusUnprocessableEntity, "Invalid id: %v", err)
+		e.Source.Pointer = "/data/id"
+		return reflect.Value{}, e
+	}
+
+	return reflect.ValueOf(value).Convert(t.pk.typ), nil
+}
+
+// isInteger reports if primary key is integer, that is autoincremented by database
+func (t *table) isInteger() bool {
+	switch t.pk.typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,150 @@
+package sql
+
+import (
+	"bytes"
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MaxStatements limits number of cached prepared statements. Statements of
+// queries that do not fit in cache are prepared and closed on each use.
+var MaxStatements = 256
+
+// dialect holds differences in SQL of database adapters
+type dialect struct {
+	quote string
+
+	// numbered placeholders $1, $2 instead of ?
+	numbered bool
+	// INSERT ... RETURNING instead of LastInsertId
+	returning bool
+}
+
+var dialects = map[string]dialect{
+	"postgres": {quote: `"`, numbered: true, returning: true},
+	"mysql":    {quote: "`"},
+	"sqlite3":  {quote: `"`},
+}
+
+// Quote quotes table or column name
+func (d dialect) Quote(name string) string {
+	return d.quote + strings.Replace(name, d.quote, d.quote+d.quote, -1) + d.quote
+}
+
+// rebind replaces ? placeholders outside of quotes with numbered ones, if dialect uses them
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b bytes.Buffer
+	var quote rune
+	n := 0
+
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// statements caches prepared statements by query
+type statements struct {
+	sync.Mutex
+	db    *sql.DB
+	stmts map[string]*sql.Stmt
+}
+
+// prepare returns prepared statement of query, and function to call when
+// statement is no longer used
+func (s *statements) prepare(query string) (*sql.Stmt, func(), error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if stmt, ok := s.stmts[query]; ok {
+		return stmt, func() {}, nil
+	}
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(s.stmts) >= MaxStatements {
+		return stmt, func() { stmt.Close() }, nil
+	}
+
+	s.stmts[query] = stmt
+	return stmt, func() {}, nil
+}
+
+// close closes all cached statements
+func (s *statements) close() {
+	s.Lock()
+	defer s.Unlock()
+
+	for query, stmt := range s.stmts {
+		stmt.Close()
+		delete(s.stmts, query)
+	}
+}
+
+// withStmt calls fn with prepared statement of query, that is
+// bound to transaction of driver if there is one
+func (d *sqlDriver) withStmt(query string, fn func(stmt *sql.Stmt) error) error {
+	stmt, release, err := d.stmts.prepare(d.dialect.rebind(query))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if d.tx != nil {
+		stmt = d.tx.Stmt(stmt)
+		defer stmt.Close()
+	}
+
+	return fn(stmt)
+}
+
+// exec executes query with arguments
+func (d *sqlDriver) exec(query string, args ...interface{}) (result sql.Result, err error) {
+	err = d.withStmt(query, func(stmt *sql.Stmt) error {
+		result, err = stmt.Exec(args...)
+		return err
+	})
+
+	return result, err
+}
+
+// scan runs query with arguments, and calls fn for each row
+func (d *sqlDriver) scan(query string, args []interface{}, fn func(rows *sql.Rows) error) error {
+	return d.withStmt(query, func(stmt *sql.Stmt) error {
+		rows, err := stmt.Query(args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			if err := fn(rows); err != nil {
+				return err
+			}
+		}
+
+		return rows.Err()
+	})
+}
@@ -0,0 +1,210 @@
+package jsonapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validator interface is implemented by models that check resource before
+// it is created (create is true) or updated. Errors without source pointer
+// are reported for whole resource.
+type Validator interface {
+	Validate(resource *Resource, create bool) []error
+}
+
+// AttributeNamer is implemented by drivers that name resource attributes
+// differently from LowerInitial of model field name
+type AttributeNamer interface {
+	AttributeName(model interface{}, field string) string
+}
+
+// ValidateResource checks resource attributes against `validate` struct
+// tags of model fields, ie. `validate:"required,email,max=64"`, and calls
+// Validator of model. All failures are returned as "422 Unprocessable Entity"
+// errors, with source pointer to attribute. Tags should be checked by
+// CheckRules when model is registered.
+func ValidateResource(db Database, model interface{}, resource *Resource, create bool) []error {
+	errs := []error{}
+
+	if resource == nil {
+		e := NewErr(http.StatusUnprocessableEntity, "Missing resource object")
+		e.Source.Pointer = "/data"
+		return append(errs, e)
+	}
+
+	modelType := reflect.TypeOf(model)
+	for modelType != nil && modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	if modelType != nil && modelType.Kind() == reflect.Struct {
+		for i := 0; i < modelType.NumField(); i++ {
+			field := modelType.Field(i)
+			rules := field.Tag.Get("validate")
+			if rules == "" || rules == "-" {
+				continue
+			}
+
+			name := LowerInitial(field.Name)
+			if namer, ok := db.(AttributeNamer); ok {
+				name = namer.AttributeName(model, field.Name)
+			}
+
+			errs = append(errs, validateAttribute(resource, name, rules, create)...)
+		}
+	}
+
+	if validator, ok := model.(Validator); ok {
+		for _, err := range validator.Validate(resource, create) {
+			if _, ok := err.(*Err); !ok {
+				e := NewErr(http.StatusUnprocessableEntity, "%v", err)
+				e.Source.Pointer = "/data"
+				err = e
+			}
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// validateAttribute checks attribute value against comma separated rules
+func validateAttribute(resource *Resource, name, rules string, create bool) []error {
+	errs := []error{}
+	value, present := resource.Attributes[name]
+
+	for _, rule := range strings.Split(rules, ",") {
+		rule, arg := splitRule(rule)
+
+		// Only required is checked for missing or null attribute.
+		// Missing attribute is not changed on update.
+		if rule == "required" {
+			if (create && !present) || (present && isEmpty(value)) {
+				errs = append(errs, ErrAttribute(name, "%v is required", name))
+			}
+			continue
+		}
+
+		if !present || value == nil {
+			continue
+		}
+
+		if err := checkRule(name, rule, arg, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// CheckRules checks `validate` struct tags of model fields, so that unknown
+// rules and invalid arguments are reported when model is registered, and
+// not when resource is validated.
+func CheckRules(model interface{}) error {
+	modelType := reflect.TypeOf(model)
+	for modelType != nil && modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	if modelType == nil || modelType.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		rules := field.Tag.Get("validate")
+		if rules == "" || rules == "-" {
+			continue
+		}
+
+		for _, rule := range strings.Split(rules, ",") {
+			rule, arg := splitRule(rule)
+
+			switch rule {
+			case "required", "email":
+			case "min", "max":
+				if _, err := strconv.ParseFloat(arg, 64); err != nil {
+					return fmt.Errorf("invalid %v rule %q of %v.%v", rule, arg, modelType.Name(), field.Name)
+				}
+			default:
+				return fmt.Errorf("unknown validation rule %q of %v.%v", rule, modelType.Name(), field.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// splitRule splits rule to its name and argument, ie. "max=64"
+func splitRule(rule string) (string, string) {
+	rule = strings.TrimSpace(rule)
+	if i := strings.Index(rule, "="); i >= 0 {
+		return rule[:i], rule[i+1:]
+	}
+
+	return rule, ""
+}
+
+// checkRule checks single validation rule with argument
+func checkRule(name, rule, arg string, value interface{}) error {
+	switch rule {
+	case "email":
+		str, ok := value.(string)
+		if !ok {
+			return ErrAttribute(name, "%v must be a string", name)
+		}
+
+		if address, err := mail.ParseAddress(str); err != nil || address.Address != str {
+			return ErrAttribute(name, "%v must be a valid email address", name)
+		}
+
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return NewErr(http.StatusInternalServerError, "Invalid %v rule of %v", rule, name)
+		}
+
+		size, unit, ok := measure(value)
+		if !ok {
+			return nil
+		}
+
+		if rule == "min" && size < limit {
+			return ErrAttribute(name, "%v must be at least %v%v", name, arg, unit)
+		}
+
+		if rule == "max" && size > limit {
+			return ErrAttribute(name, "%v must be at most %v%v", name, arg, unit)
+		}
+
+	default:
+		return NewErr(http.StatusInternalServerError, "Unknown validation rule %q of %v", rule, name)
+	}
+
+	return nil
+}
+
+// measure returns length of string or array, or value of number
+func measure(value interface{}) (float64, string, bool) {
+	switch v := value.(type) {
+	case string:
+		return float64(utf8.RuneCountInString(v)), " characters long", true
+	case float64:
+		return v, "", true
+	case []interface{}:
+		return float64(len(v)), " items", true
+	}
+
+	return 0, "", false
+}
+
+// isEmpty reports if attribute value is null or empty string
+func isEmpty(value interface{}) bool {
+	str, ok := value.(string)
+	return value == nil || (ok && str == "")
+}
@@ -1,6 +1,10 @@
 package ibis
 
 import (
+	"net/http"
+
+	"github.com/dmajkic/ibis/jsonapi"
+
 	"github.com/gin-gonic/gin"
 	"github.com/nu7hatch/gouuid"
 )
@@ -18,13 +22,20 @@ func (s *Server) SetMiddleware(router *gin.Engine) {
 	router.Use(CORSMiddleware())
 }
 
-// TracerMiddleware adds session reference, uuid identification to every request
+// TracerMiddleware adds session reference, uuid identification to every request.
+// Request id is kept from X-Request-ID header, or set to uuid, so it can be
+// passed to remote services, and it is returned in response header.
 func TracerMiddleware(s *Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := uuid.NewV4()
 
 		c.Set("uuid", id)
 		c.Set("Server", s)
+
+		if c.Request.Header.Get("X-Request-ID") == "" {
+			c.Request.Header.Set("X-Request-ID", id.String())
+		}
+		c.Header("X-Request-ID", c.Request.Header.Get("X-Request-ID"))
 	}
 }
 
@@ -41,3 +52,32 @@ func CORSMiddleware() gin.HandlerFunc {
 		}
 	}
 }
+
+// JSONAPIMiddleware negotiates JSONAPI media type with client. Request document must be
+// sent as application/vnd.api+json ("415 Unsupported Media Type"), and Accept header must
+// allow it ("406 Not Acceptable"). Only listed extensions can be requested. Response is sent
+// as JSONAPI media type with applied extensions, that are stored in context as "media_type".
+func JSONAPIMiddleware(extensions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", jsonapi.MediaType)
+
+		accepted, err := jsonapi.CheckAccept(c.Request.Header.Get("Accept"), extensions...)
+		if err != nil {
+			JSONError(c, http.StatusNotAcceptable, err)
+			c.Abort()
+			return
+		}
+
+		applied := accepted
+		if c.Request.Method == "POST" || c.Request.Method == "PATCH" || c.Request.ContentLength > 0 {
+			if applied, err = jsonapi.CheckContentType(c.Request.Header.Get("Content-Type"), extensions...); err != nil {
+				JSONError(c, http.StatusUnsupportedMediaType, err)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("media_type", applied)
+		c.Header("Content-Type", applied.ContentType())
+	}
+}
@@ -0,0 +1,306 @@
+package ibis
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dmajkic/ibis/jsonapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// model returns model of resource type set with Resource
+func (s *Server) model(typeName string) (interface{}, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	model, ok := s.models[typeName]
+	return model, ok
+}
+
+// operationError returns error of i-th operation, with source pointer
+// relative to request document
+func operationError(i int, err error) error {
+	var e jsonapi.Err
+
+	switch v := err.(type) {
+	case jsonapi.Errors:
+		errs := make(jsonapi.Errors, len(v))
+		for j := range v {
+			errs[j] = operationError(i, v[j])
+		}
+		return errs
+	case *jsonapi.Err:
+		e = *v
+	default:
+		code := http.StatusInternalServerError
+		if err == jsonapi.ErrNotFound {
+			code = http.StatusNotFound
+		}
+		e = *jsonapi.NewErr(code, "%v", err)
+	}
+
+	e.Source.Pointer = fmt.Sprintf("/atomic:operations/%d%v", i, e.Source.Pointer)
+	return &e
+}
+
+// operationResource decodes resource object of add and update operation,
+// resolving local ids in its relationships
+func operationResource(op *jsonapi.Operation, lids jsonapi.LocalIDs) (*jsonapi.Resource, error) {
+	if len(op.Data) == 0 {
+		return nil, jsonapi.NewErr(http.StatusBadRequest, "Missing data member")
+	}
+
+	resource := jsonapi.NewResource("", "")
+	if err := json.Unmarshal(op.Data, resource); err != nil {
+		e := jsonapi.NewErr(http.StatusBadRequest, "Invalid resource object: %v", err)
+		e.Source.Pointer = "/data"
+		return nil, e
+	}
+
+	for name, rel := range resource.Relationships {
+		if rel == nil || rel.Data == nil {
+			continue
+		}
+
+		if err := lids.Resolve(rel.Data, "/data/relationships/"+name+"/data"); err != nil {
+			return nil, err
+		}
+	}
+
+	return resource, nil
+}
+
+// operationRef returns target of operation, from ref member or resource object.
+// Local id of target is resolved to server id.
+func operationRef(op *jsonapi.Operation, resource *jsonapi.Resource, lids jsonapi.LocalIDs) (*jsonapi.OperationRef, string, error) {
+	if op.Href != "" {
+		e := jsonapi.NewErr(http.StatusBadRequest, "Operation href is not supported, use ref")
+		e.Source.Pointer = "/href"
+		return nil, "", e
+	}
+
+	ref, pointer := op.Ref, "/ref"
+	if ref == nil {
+		if resource == nil {
+			return nil, "", jsonapi.NewErr(http.StatusBadRequest, "Missing ref member")
+		}
+
+		ref, pointer = &jsonapi.OperationRef{Type: resource.Type, ID: resource.ID, Lid: resource.Lid}, "/data"
+	}
+
+	if ref.ID == "" && ref.Lid != "" && !(op.Op == jsonapi.OpAdd && op.Ref == nil) {
+		id, ok := lids.Get(ref.Type, ref.Lid)
+		if !ok {
+			e := jsonapi.NewErr(http.StatusBadRequest, "Unknown local id %q of %v resource", ref.Lid, ref.Type)
+			e.Source.Pointer = pointer + "/lid"
+			return nil, "", e
+		}
+
+		ref = &jsonapi.OperationRef{Type: ref.Type, ID: id, Relationship: ref.Relationship}
+	}
+
+	return ref, pointer, nil
+}
+
+// runRelationshipOperation changes relationship linkage targeted by operation ref
+func runRelationshipOperation(db jsonapi.Database, model interface{}, op *jsonapi.Operation, ref *jsonapi.OperationRef, lids jsonapi.LocalIDs) error {
+	rdb, ok := db.(jsonapi.RelationshipDatabase)
+	if !ok {
+		e := jsonapi.NewErr(http.StatusBadRequest, "Relationship operations are not supported")
+		e.Source.Pointer = "/ref/relationship"
+		return e
+	}
+
+	data := &jsonapi.RelationshipData{}
+	if err := json.Unmarshal(op.Data, data); len(op.Data) == 0 || err != nil {
+		e := jsonapi.NewErr(http.StatusBadRequest, "Invalid resource linkage")
+		e.Source.Pointer = "/data"
+		return e
+	}
+
+	if err := lids.Resolve(data, "/data"); err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case jsonapi.OpAdd:
+		return rdb.AddRelationship(model, ref.ID, ref.Relationship, data)
+	case jsonapi.OpUpdate:
+		return rdb.UpdateRelationship(model, ref.ID, ref.Relationship, data)
+	default:
+		return rdb.DeleteRelationship(model, ref.ID, ref.Relationship, data)
+	}
+}
+
+// runOperation applies single operation to database
+func (s *Server) runOperation(db jsonapi.Database, op *jsonapi.Operation, lids jsonapi.LocalIDs) (jsonapi.OperationResult, error) {
+	var err error
+	var resource *jsonapi.Resource
+
+	result := jsonapi.OperationResult{}
+
+	switch op.Op {
+	case jsonapi.OpAdd, jsonapi.OpUpdate:
+		if op.Ref == nil || op.Ref.Relationship == "" {
+			if resource, err = operationResource(op, lids); err != nil {
+				return result, err
+			}
+		}
+	case jsonapi.OpRemove:
+	default:
+		e := jsonapi.NewErr(http.StatusBadRequest, "Unknown operation %q", op.Op)
+		e.Source.Pointer = "/op"
+		return result, e
+	}
+
+	ref, pointer, err := operationRef(op, resource, lids)
+	if err != nil {
+		return result, err
+	}
+
+	model, ok := s.model(ref.Type)
+	if !ok {
+		e := jsonapi.NewErr(http.StatusNotFound, "Unknown resource type %q", ref.Type)
+		e.Source.Pointer = pointer + "/type"
+		return result, e
+	}
+
+	if ref.Relationship != "" {
+		return result, runRelationshipOperation(db, model, op, ref, lids)
+	}
+
+	if resource != nil && op.Ref != nil && (resource.Type != ref.Type || (resource.ID != "" && resource.ID != ref.ID)) {
+		e := jsonapi.NewErr(http.StatusConflict, "Resource does not match operation ref")
+		e.Source.Pointer = "/data"
+		return result, e
+	}
+
+	if op.Op == jsonapi.OpAdd {
+		if err = jsonapi.CheckClientID(model, resource.ID); err != nil {
+			return result, err
+		}
+	}
+
+	if resource != nil {
+		if errs := jsonapi.ValidateResource(db, model, resource, op.Op == jsonapi.OpAdd); len(errs) > 0 {
+			return result, jsonapi.Errors(errs)
+		}
+	}
+
+	var item *jsonapi.DocItem
+
+	switch op.Op {
+	case jsonapi.OpAdd:
+		if item, err = db.Create(model, &jsonapi.DocItem{Data: resource}); err == nil && item == nil {
+			item, err = db.FindRecord(model, resource.ID, jsonapi.NewQuery())
+		}
+
+		if err == nil && resource.Lid != "" {
+			lids.Set(resource.Type, resource.Lid, item.Data.ID)
+			item.Data.Lid = resource.Lid
+		}
+
+	case jsonapi.OpUpdate:
+		if ref.ID == "" {
+			e := jsonapi.NewErr(http.StatusBadRequest, "Missing id of updated resource")
+			e.Source.Pointer = pointer
+			return result, e
+		}
+
+		resource.ID = ref.ID
+		if err = db.Update(model, ref.ID, &jsonapi.DocItem{Data: resource}); err == nil {
+			item, err = db.FindRecord(model, ref.ID, jsonapi.NewQuery())
+		}
+
+	case jsonapi.OpRemove:
+		err = db.Delete(model, ref.ID)
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	if item != nil {
+		result.Data = item.Data
+	}
+
+	return result, nil
+}
+
+// Handler for Atomic Operations request. All operations are applied in
+// single transaction; if any of them fails, none is applied.
+func (s *Server) operationsHandler(db jsonapi.Database) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if media, ok := c.Get("media_type"); ok && !media.(jsonapi.MediaTypeParams).HasExt(jsonapi.AtomicExtension) {
+			e := jsonapi.NewErr(http.StatusUnsupportedMediaType, "Atomic Operations require ext=%q media type parameter", jsonapi.AtomicExtension)
+			e.Source.Header = "Content-Type"
+			JSONError(c, http.StatusUnsupportedMediaType, e)
+			return
+		}
+
+		doc := &jsonapi.DocOperations{}
+
+		if err := c.BindJSON(doc); err != nil {
+			JSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if len(doc.Operations) == 0 {
+			e := jsonapi.NewErr(http.StatusBadRequest, "Missing atomic:operations member")
+			e.Source.Pointer = "/atomic:operations"
+			JSONError(c, http.StatusBadRequest, e)
+			return
+		}
+
+		results := make([]jsonapi.OperationResult, len(doc.Operations))
+		lids := jsonapi.LocalIDs{}
+		hasData := false
+
+		tdb, ok := forRequest(db, c).(jsonapi.TransactionDatabase)
+		if !ok {
+			tdb = db.(jsonapi.TransactionDatabase)
+		}
+
+		err := tdb.Transaction(func(tx jsonapi.Database) error {
+			for i := range doc.Operations {
+				result, err := s.runOperation(tx, &doc.Operations[i], lids)
+				if err != nil {
+					return operationError(i, err)
+				}
+
+				results[i] = result
+				hasData = hasData || result.Data != nil
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			JSONError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !hasData {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.JSON(http.StatusOK, &jsonapi.DocResults{
+			Results: results,
+			JSONApi: &jsonapi.VersionMeta{Version: "1.1", Ext: []string{jsonapi.AtomicExtension}},
+		})
+	}
+}
+
+// Operations sets Atomic Operations endpoint /operations for resources
+// set with Resource, if database driver supports transactions
+func (s *Server) Operations(router *gin.RouterGroup) {
+	if _, ok := s.Db.(jsonapi.TransactionDatabase); !ok {
+		return
+	}
+
+	router = router.Group("", JSONAPIMiddleware(jsonapi.AtomicExtension))
+	router.POST("/operations", s.operationsHandler(s.Db))
+}
@@ -0,0 +1,193 @@
+package ibis
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/dmajkic/ibis/jsonapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// relationshipLinks returns self and related links of relationship endpoint
+func relationshipLinks(c *gin.Context) *jsonapi.Links {
+	self := requestURL(c)
+	self.RawQuery = ""
+
+	related := *self
+	related.Path = strings.Replace(related.Path, "/relationships/", "/", 1)
+
+	return &jsonapi.Links{Self: self.String(), Related: related.String()}
+}
+
+// bindLinkage decodes resource linkage from relationship request document
+func bindLinkage(c *gin.Context) (*jsonapi.RelationshipData, error) {
+	var doc struct {
+		Data json.RawMessage `json:"data"`
+	}
+
+	if err := c.BindJSON(&doc); err != nil {
+		return nil, jsonapi.NewErr(http.StatusBadRequest, "%v", err)
+	}
+
+	if len(doc.Data) == 0 {
+		return nil, jsonapi.NewErr(http.StatusBadRequest, "Missing data member")
+	}
+
+	data := &jsonapi.RelationshipData{}
+	if err := json.Unmarshal(doc.Data, data); err != nil {
+		e := jsonapi.NewErr(http.StatusBadRequest, "Invalid resource linkage: %v", err)
+		e.Source.Pointer = "/data"
+		return nil, e
+	}
+
+	return data, nil
+}
+
+// relationshipError returns JSONAPI error for relationship endpoint
+func relationshipError(c *gin.Context, err error) {
+	if err == jsonapi.ErrNotFound {
+		JSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	JSONError(c, http.StatusInternalServerError, err)
+}
+
+// Handler to return resource linkage of relationship
+func (s *Server) getRelationshipHandler(db jsonapi.Database, model interface{}) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		rel, err := relationshipDatabase(db, c).FindRelationship(model, c.Param("id"), c.Param("relationship"))
+		if err != nil {
+			relationshipError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, &jsonapi.DocRelationship{
+			Data:    *rel.Data,
+			Meta:    rel.Meta,
+			Links:   relationshipLinks(c),
+			JSONApi: &jsonapi.VersionMeta{Version: "1.0"},
+		})
+	}
+}
+
+// Handler for PATCH, POST and DELETE of relationship linkage
+func (s *Server) changeRelationshipHandler(db jsonapi.Database, change func(rdb jsonapi.RelationshipDatabase, model, id interface{}, name string, data *jsonapi.RelationshipData) error, model interface{}) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		data, err := bindLinkage(c)
+		if err != nil {
+			JSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := change(relationshipDatabase(db, c), model, c.Param("id"), c.Param("relationship"), data); err != nil {
+			relationshipError(c, err)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// relationshipRoutes sets relationship endpoints, if database driver supports them
+func (s *Server) relationshipRoutes(router *gin.RouterGroup, name string, db jsonapi.Database, model interface{}) {
+	if _, ok := db.(jsonapi.RelationshipDatabase); !ok {
+		return
+	}
+
+	path := "/" + name + "/:id/relationships/:relationship"
+
+	router.GET(path, s.getRelationshipHandler(db, model))
+	router.PATCH(path, s.changeRelationshipHandler(db, jsonapi.RelationshipDatabase.UpdateRelationship, model))
+	router.POST(path, s.changeRelationshipHandler(db, jsonapi.RelationshipDatabase.AddRelationship, model))
+	router.DELETE(path, s.changeRelationshipHandler(db, jsonapi.RelationshipDatabase.DeleteRelationship, model))
+}
+
+// relationshipDatabase returns database bound to client request. Routes are set
+// only for RelationshipDatabase, so db is used if bound database is not one.
+func relationshipDatabase(db jsonapi.Database, c *gin.Context) jsonapi.RelationshipDatabase {
+	if rdb, ok := forRequest(db, c).(jsonapi.RelationshipDatabase); ok {
+		return rdb
+	}
+
+	return db.(jsonapi.RelationshipDatabase)
+}
+
+// Handler to return related resource of to-one relationship
+func (s *Server) getRelatedRecordHandler(db jsonapi.Database, model interface{}, name string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		query, err := jsonapi.ParseQuery(c.Request.URL.Query())
+		if err != nil {
+			JSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		result, err := relatedDatabase(db, c).FindRelatedRecord(model, c.Param("id"), name, query)
+		if err != nil {
+			relationshipError(c, err)
+			return
+		}
+
+		// Empty to-one relationship is represented with "data": null
+		if result.Data == nil {
+			c.JSON(http.StatusOK, gin.H{"data": nil, "jsonapi": result.JSONApi})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// Handler to return related resources of to-many relationship
+func (s *Server) getRelatedAllHandler(db jsonapi.Database, model interface{}, name string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		query, err := jsonapi.ParseQuery(c.Request.URL.Query())
+		if err != nil {
+			JSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		result, err := relatedDatabase(db, c).FindRelatedAll(model, c.Param("id"), name, query)
+		if err != nil {
+			relationshipError(c, err)
+			return
+		}
+
+		if result.Links != nil {
+			result.Links.Resolve(requestURL(c))
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// relatedRoutes sets related resource endpoint for every relationship of model,
+// if database driver supports them
+func (s *Server) relatedRoutes(router *gin.RouterGroup, name string, db jsonapi.Database, model interface{}) {
+	rdb, ok := db.(jsonapi.RelatedDatabase)
+	if !ok {
+		return
+	}
+
+	for relationship, toOne := range rdb.Relationships(model) {
+		path := "/" + name + "/:id/" + relationship
+
+		if toOne {
+			router.GET(path, s.getRelatedRecordHandler(db, model, relationship))
+		} else {
+			router.GET(path, s.getRelatedAllHandler(db, model, relationship))
+		}
+	}
+}
+
+// relatedDatabase returns database bound to client request. Routes are set
+// only for RelatedDatabase, so db is used if bound database is not one.
+func relatedDatabase(db jsonapi.Database, c *gin.Context) jsonapi.RelatedDatabase {
+	if rdb, ok := forRequest(db, c).(jsonapi.RelatedDatabase); ok {
+		return rdb
+	}
+
+	return db.(jsonapi.RelatedDatabase)
+}
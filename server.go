@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/dmajkic/ibis/jsonapi"
@@ -25,6 +26,12 @@ type Config struct {
 	DbURL          string
 	DbAdapter      string
 	Stderr, Stdout string
+
+	// Read replicas of DbURL, for drivers that support them
+	DbReplicas []string
+
+	// Default and maximum page[size] for collections, if not zero
+	PageSize, MaxPageSize int
 }
 
 // Server is core struct
@@ -36,6 +43,7 @@ type Server struct {
 	ModelDb  jsonapi.Database
 
 	exit      chan struct{}
+	models    map[string]interface{}
 	authToken string
 	Tokens    map[string]string
 	stopping  bool
@@ -68,10 +76,19 @@ func (s *Server) run() {
 
 	var err error
 
+	if s.PageSize > 0 {
+		jsonapi.DefaultPageSize = s.PageSize
+	}
+
+	if s.MaxPageSize > 0 {
+		jsonapi.MaxPageSize = s.MaxPageSize
+	}
+
 	// Database connection
 	err = s.Db.ConnectDB(map[string]string{
-		"adapter": s.DbAdapter,
-		"dbUrl":   s.DbURL,
+		"adapter":  s.DbAdapter,
+		"dbUrl":    s.DbURL,
+		"replicas": strings.Join(s.DbReplicas, "\n"),
 	})
 
 	if err != nil {
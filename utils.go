@@ -1,8 +1,13 @@
 package ibis
 
 import (
-	"fmt"
+	"bytes"
+	"encoding/json"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dmajkic/ibis/jsonapi"
 
@@ -12,6 +17,8 @@ import (
 // ResourcesFunc is a helper function to set jsonapi routes from function
 func (s *Server) ResourcesFunc(router *gin.RouterGroup, name, parent string, fn func() []interface{}) {
 
+	router = router.Group("", JSONAPIMiddleware())
+
 	models := fn()
 
 	router.GET("/"+name+"/:id", s.getIDHandler(s.ModelDb, models))
@@ -25,6 +32,8 @@ func (s *Server) ResourcesFunc(router *gin.RouterGroup, name, parent string, fn
 // Resources is a helper function to set jsonapi routes for model slice
 func (s *Server) Resources(router *gin.RouterGroup, name, parent string, models ...interface{}) {
 
+	router = router.Group("", JSONAPIMiddleware())
+
 	router.GET("/"+name+"/:id", s.getIDHandler(s.ModelDb, models))
 	router.GET("/"+name, s.getHandler(s.ModelDb, models, parent))
 	router.DELETE("/"+name+"/:id", s.deleteHandler(s.ModelDb, models))
@@ -33,8 +42,28 @@ func (s *Server) Resources(router *gin.RouterGroup, name, parent string, models
 	// OPTIONS supported via CORSMiddleware()
 }
 
-// Resource is a helper function to set jsonapi routes for model
-func (s *Server) Resource(router *gin.RouterGroup, name, parent string, model interface{}) {
+// Resource is a helper function to set jsonapi routes for model.
+// Optional resource options are registered for model type, ie. pagination mode.
+func (s *Server) Resource(router *gin.RouterGroup, name, parent string, model interface{}, options ...jsonapi.ResourceOptions) {
+
+	// Invalid validation tag is programming error, found at startup
+	if err := jsonapi.CheckRules(model); err != nil {
+		panic(err)
+	}
+
+	router = router.Group("", JSONAPIMiddleware())
+
+	for _, opts := range options {
+		jsonapi.SetResourceOptions(model, opts)
+	}
+
+	// Resource type is known to Atomic Operations endpoint
+	s.Lock()
+	if s.models == nil {
+		s.models = make(map[string]interface{})
+	}
+	s.models[name] = model
+	s.Unlock()
 
 	if meta, ok := model.(jsonapi.MetaFiller); ok {
 		router.GET("/"+name+"/:id", s.getIDMetaHandler(s.Db, model, meta))
@@ -47,13 +76,49 @@ func (s *Server) Resource(router *gin.RouterGroup, name, parent string, model in
 	router.PATCH("/"+name+"/:id", s.patchHandler(s.Db, model))
 	router.POST("/"+name, s.postHandler(s.Db, model))
 	// OPTIONS supported via CORSMiddleware()
+
+	s.relationshipRoutes(router, name, s.Db, model)
+	s.relatedRoutes(router, name, s.Db, model)
+}
+
+// RetryAfter is sent in Retry-After header of "503 Service Unavailable"
+// responses, ie. when database is busy or transaction is deadlocked
+var RetryAfter = time.Second
+
+// setRetryAfter sets Retry-After header for "503 Service Unavailable" response
+func setRetryAfter(c *gin.Context, errorCode int) {
+	if errorCode != http.StatusServiceUnavailable {
+		return
+	}
+
+	seconds := int(RetryAfter / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	c.Header("Retry-After", strconv.Itoa(seconds))
 }
 
-// JSONError is a helper fuction to return JSONAPI error with errorcode
+// JSONError is a helper fuction to return JSONAPI error with errorcode.
+// If err is jsonapi.Err or jsonapi.Errors, its own status code is used instead.
 func JSONError(c *gin.Context, errorCode int, err error) {
+	if e, ok := err.(interface {
+		StatusCode() int
+	}); ok {
+		errorCode = e.StatusCode()
+	}
+
+	setRetryAfter(c, errorCode)
+
 	c.JSON(errorCode, jsonapi.DocError(errorCode, err))
 }
 
+// JSONErrors is a helper fuction to return all errors in one JSONAPI document
+func JSONErrors(c *gin.Context, errorCode int, errs ...error) {
+	setRetryAfter(c, errorCode)
+	c.JSON(errorCode, jsonapi.DocError(errorCode, errs...))
+}
+
 // JSONError500 is a helper function to return JSONAPI 500 Internal Server
 func JSONError500(c *gin.Context, err error) {
 	c.JSON(500, jsonapi.DocError(500, err))
@@ -66,9 +131,38 @@ func JSONError422(c *gin.Context, source string, err error) {
 	c.JSON(422, data)
 }
 
+// forRequest returns database bound to client request and its authenticated user
+func forRequest(db jsonapi.Database, c *gin.Context) jsonapi.Database {
+	request := c.Request
+	if userID, ok := c.Get("user_id"); ok {
+		request = jsonapi.WithUser(request, userID)
+	}
+
+	return jsonapi.ForRequest(db, request)
+}
+
+// requestURL returns absolute URL of request, used to resolve document links
+func requestURL(c *gin.Context) *url.URL {
+	u := *c.Request.URL
+	u.Host = c.Request.Host
+	u.Scheme = "http"
+
+	if c.Request.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	if proto := c.Request.Header.Get("X-Forwarded-Proto"); proto != "" {
+		u.Scheme = proto
+	}
+
+	return &u
+}
+
 // Handler to return JSONAPI resource array, with optional parent
 func (s *Server) getHandler(db jsonapi.Database, model interface{}, parent string) func(c *gin.Context) {
 	return func(c *gin.Context) {
+		db := forRequest(db, c)
+
 		var parentID string
 
 		if len(parent) == 0 {
@@ -77,12 +171,22 @@ func (s *Server) getHandler(db jsonapi.Database, model interface{}, parent strin
 			parentID = c.DefaultQuery(parent, "")
 		}
 
-		result, err := db.FindAll(model, parentID, c.Request.URL.RawQuery)
+		query, err := jsonapi.ParseQuery(c.Request.URL.Query(), parent)
+		if err != nil {
+			JSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		result, err := db.FindAll(model, parentID, query)
 		if err != nil {
 			JSONError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		if result.Links != nil {
+			result.Links.Resolve(requestURL(c))
+		}
+
 		c.JSON(200, result)
 	}
 }
@@ -90,9 +194,17 @@ func (s *Server) getHandler(db jsonapi.Database, model interface{}, parent strin
 // getIDMetaHandler is for single model with support for MetaFiller interface
 func (s *Server) getIDMetaHandler(db jsonapi.Database, model interface{}, meta jsonapi.MetaFiller) func(c *gin.Context) {
 	return func(c *gin.Context) {
+		db := forRequest(db, c)
+
 		id := c.Param("id")
 
-		result, err := db.FindRecord(model, id, c.Request.URL.RawQuery)
+		query, err := jsonapi.ParseQuery(c.Request.URL.Query())
+		if err != nil {
+			JSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		result, err := db.FindRecord(model, id, query)
 
 		if err == jsonapi.ErrNotFound {
 			JSONError(c, http.StatusNotFound, err)
@@ -122,9 +234,17 @@ func (s *Server) getIDMetaHandler(db jsonapi.Database, model interface{}, meta j
 // Handler to return single JSONAPI resource for specified id
 func (s *Server) getIDHandler(db jsonapi.Database, model interface{}) func(c *gin.Context) {
 	return func(c *gin.Context) {
+		db := forRequest(db, c)
+
 		id := c.Param("id")
 
-		result, err := db.FindRecord(model, id, c.Request.URL.RawQuery)
+		query, err := jsonapi.ParseQuery(c.Request.URL.Query())
+		if err != nil {
+			JSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		result, err := db.FindRecord(model, id, query)
 
 		if err == jsonapi.ErrNotFound {
 			JSONError(c, http.StatusNotFound, err)
@@ -151,6 +271,8 @@ func (s *Server) getIDHandler(db jsonapi.Database, model interface{}) func(c *gi
 // Handler to delete JSONAPI resource
 func (s *Server) deleteHandler(db jsonapi.Database, model interface{}) func(c *gin.Context) {
 	return func(c *gin.Context) {
+		db := forRequest(db, c)
+
 		id := c.Param("id")
 
 		err := db.Delete(model, id)
@@ -170,6 +292,8 @@ func (s *Server) deleteHandler(db jsonapi.Database, model interface{}) func(c *g
 // Handler for PATCH to update JSONAPI resource
 func (s *Server) patchHandler(db jsonapi.Database, model interface{}) func(c *gin.Context) {
 	return func(c *gin.Context) {
+		db := forRequest(db, c)
+
 		data := &jsonapi.DocItem{
 			Data:  jsonapi.NewResource("", ""),
 			Meta:  make(map[string]interface{}),
@@ -177,28 +301,123 @@ func (s *Server) patchHandler(db jsonapi.Database, model interface{}) func(c *gi
 		}
 
 		if err := c.BindJSON(&data); err != nil {
-			JSONError(c, 422, err)
+			JSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		query, err := jsonapi.ParseQuery(c.Request.URL.Query())
+		if err != nil {
+			JSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if data.Data == nil || data.Data.ID == "" {
+			e := jsonapi.NewErr(http.StatusBadRequest, "Missing id of updated resource")
+			e.Source.Pointer = "/data/id"
+			JSONError(c, http.StatusBadRequest, e)
 			return
 		}
 
 		id := c.Param("id")
 		if id != data.Data.ID {
-			JSONError(c, 422, fmt.Errorf("Wrong resource for update"))
+			e := jsonapi.NewErr(http.StatusConflict, "Resource id %q does not match endpoint", data.Data.ID)
+			e.Source.Pointer = "/data/id"
+			JSONError(c, http.StatusConflict, e)
+			return
+		}
+
+		// Current state of resource, to tell if update changes more than requested
+		before, err := db.FindRecord(model, id, jsonapi.NewQuery())
+		if err == jsonapi.ErrNotFound {
+			JSONError(c, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			JSONError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if data.Data.Type != before.Data.Type {
+			e := jsonapi.NewErr(http.StatusConflict, "Resource type %q does not match endpoint", data.Data.Type)
+			e.Source.Pointer = "/data/type"
+			JSONError(c, http.StatusConflict, e)
+			return
+		}
+
+		if errs := jsonapi.ValidateResource(db, model, data.Data, false); len(errs) > 0 {
+			JSONErrors(c, http.StatusUnprocessableEntity, errs...)
+			return
+		}
+
+		if err := db.Update(model, id, data); err == jsonapi.ErrNotFound {
+			JSONError(c, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			JSONError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		result, err := db.FindRecord(model, id, query)
+		if err != nil {
+			JSONError(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		if err := db.Update(model, id, data); err != nil {
-			JSONError(c, 422, err)
+		if onlyRequested(before.Data, result.Data, data.Data) {
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
-		c.JSON(http.StatusAccepted, model)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// onlyRequested reports if updated resource differs from resource before update
+// only in attributes and relationships requested by client
+func onlyRequested(before, after, requested *jsonapi.Resource) bool {
+	if len(before.Attributes) != len(after.Attributes) ||
+		len(before.Relationships) != len(after.Relationships) {
+		return false
+	}
+
+	for name, value := range after.Attributes {
+		expected, ok := requested.Attributes[name]
+		if !ok {
+			expected = before.Attributes[name]
+		}
+
+		if !sameJSON(value, expected) {
+			return false
+		}
+	}
+
+	for name, rel := range after.Relationships {
+		expected := before.Relationships[name]
+
+		// Linkage that is not in document can not differ from requested one
+		if r, ok := requested.Relationships[name]; ok && r.Data != nil && rel.Data != nil {
+			expected = r
+		}
+
+		if expected == nil || !sameJSON(rel.Data, expected.Data) {
+			return false
+		}
 	}
+
+	return true
+}
+
+// sameJSON reports if a and b have the same JSON representation
+func sameJSON(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
 }
 
 // Handler for POST to create JSONAPI resource
 func (s *Server) postHandler(db jsonapi.Database, model interface{}) func(c *gin.Context) {
 	return func(c *gin.Context) {
+		db := forRequest(db, c)
+
 		var err error
 		var result *jsonapi.DocItem
 
@@ -209,7 +428,20 @@ func (s *Server) postHandler(db jsonapi.Database, model interface{}) func(c *gin
 		}
 
 		if err = c.BindJSON(&data); err != nil {
-			JSONError(c, 422, err)
+			JSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Missing resource is reported by validation
+		if data.Data != nil {
+			if err = jsonapi.CheckClientID(model, data.Data.ID); err != nil {
+				JSONError(c, http.StatusForbidden, err)
+				return
+			}
+		}
+
+		if errs := jsonapi.ValidateResource(db, model, data.Data, true); len(errs) > 0 {
+			JSONErrors(c, http.StatusUnprocessableEntity, errs...)
 			return
 		}
 
@@ -218,6 +450,13 @@ func (s *Server) postHandler(db jsonapi.Database, model interface{}) func(c *gin
 			return
 		}
 
+		if result != nil && result.Data != nil {
+			location := requestURL(c)
+			location.RawQuery = ""
+			location.Path = strings.TrimSuffix(location.Path, "/") + "/" + url.PathEscape(result.Data.ID)
+			c.Header("Location", location.String())
+		}
+
 		c.JSON(http.StatusCreated, result)
 	}
 }